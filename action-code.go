@@ -2,13 +2,26 @@ package main
 
 
 // ActionCode is a structure that contains fields for encoding the
-// user's desired action as parsed from the command line.
+// user's desired action as parsed from the command line. The string
+// fields hold the values of options that override the config.
 type ActionCode struct {
 	Main int
 	Sub int
 	Match int
 	Sort int
 	Print int
+	PipeTo string
+	PipeMode string
+	NoConfirm bool
+	ValueFrom int
+	Bulk string
+	BulkFormat string
+	Force bool
+	TagOp string
+	TagArgs string
+	Attrs []string
+	Note string
+	IncludeExpired bool
 }
 
 // These constants are like enums. They clarify the purpose of an
@@ -20,6 +33,22 @@ const (
 	MainActHelp
 	MainActInit
 	MainActDemo
+	MainActClearClipboard
+	MainActDedupe
+	MainActRetag
+	MainActTags
+	MainActAliases
+	MainActGC
+	MainActTrash
+	MainActRestore
+	MainActEmptyTrash
+	MainActUndo
+	MainActRedo
+	MainActHistory
+	MainActBackups
+	MainActRestoreBackup
+	MainActCheck
+	MainActRepair
 )
 
 const (
@@ -28,6 +57,10 @@ const (
 	SubActPipe
 	SubActEdit
 	SubActDelete
+	SubActCopy
+	SubActTag
+	SubActPin
+	SubActUnpin
 )
 
 const (
@@ -45,20 +78,39 @@ const (
 const (
 	PrintConfig int = iota
 	PrintFull
+	PrintVerbose
 	PrintCompact
 	PrintValsOnly
 )
 
+const (
+	ValueFromTerms int = iota
+	ValueFromStdin
+	ValueFromEditor
+)
+
 
 // defaultActionCode returns a pointer to an ActionCode for the
 // default action.
 func defaultActionCode() *ActionCode {
-	return &ActionCode{MainActView, SubActConfig, MatchConfig, SortConfig, PrintConfig}
+	return &ActionCode{MainActView, SubActConfig, MatchConfig, SortConfig, PrintConfig, "", "", false, ValueFromTerms, "", "", false, "", "", nil, "", false}
 }
 
 // mergeConfigActions receives pointers to a Config and an ActionCode
 // and sets values in the ActionCode according to values in the Config.
 func mergeConfigActions(conf *Config, act *ActionCode) {
+	if len(act.PipeTo) > 0 {
+		conf.Action = checkAction(act.PipeTo, conf.Action)
+	}
+
+	if act.IncludeExpired {
+		conf.IncludeExpired = true
+	}
+
+	if len(act.PipeMode) > 0 {
+		conf.PipeMode = checkPipeMode(act.PipeMode, conf.PipeMode)
+	}
+
 	if act.Sub == SubActConfig {
 		if len(conf.Action) > 0 {
 			act.Sub = SubActPipe
@@ -84,7 +136,9 @@ func mergeConfigActions(conf *Config, act *ActionCode) {
 	}
 
 	if act.Print == PrintConfig {
-		if conf.PrintLines == "2" {
+		if conf.PrintLines == "3" {
+			act.Print = PrintVerbose
+		} else if conf.PrintLines == "2" {
 			act.Print = PrintFull
 		} else {
 			act.Print = PrintCompact
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+
+// makeAliaser returns the Aliases main action function, which lists,
+// adds, or removes tag aliases, depending on the action code's TagOp:
+//   "":        list the aliases
+//   alias:     the terms are a tag, then the aliases to add to it
+//   unalias:   the terms are the aliases to remove, or tags to remove
+//              all the aliases of
+// The aliases are saved in the config file.
+func makeAliaser(conf *Config, act *ActionCode, terms []string) func() {
+	aliaser := func() {
+		for o := range terms {
+			terms[o] = cleanTagPath(terms[o])
+		}
+
+		switch {
+		case act.TagOp == "alias":
+			if len(terms) < 2 {
+				fmt.Fprintf(os.Stderr, "To alias a tag:\n  $ star --alias tag alias1[ alias2...]\n")
+				return
+			}
+			if err := addTagAliases(conf.TagAliases, terms[0], terms[1:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%v\n", err)
+				return
+			}
+			saveTagAliasesToConfig(conf.TagAliases)
+			fmt.Printf("Added %v to `%v`.\n", pluralize(len(terms) - 1, "alias", "aliases"), terms[0])
+		case act.TagOp == "unalias":
+			if len(terms) == 0 {
+				fmt.Fprintf(os.Stderr, "To remove aliases:\n  $ star --unalias alias1[ alias2...]\n")
+				return
+			}
+			count := removeTagAliases(conf.TagAliases, terms)
+			if count == 0 {
+				fmt.Printf("No aliases removed.\n")
+				return
+			}
+			saveTagAliasesToConfig(conf.TagAliases)
+			fmt.Printf("Removed %v.\n", pluralize(count, "alias", "aliases"))
+		default:
+			printTagAliases(conf.TagAliases)
+		}
+	}
+
+	return aliaser
+}
+
+// saveTagAliasesToConfig saves the given tag aliases in the user's
+// config file, without changing the rest of it.
+func saveTagAliasesToConfig(aliases map[string][]string) {
+	if len(aliases) == 0 {
+		saveConfigKey("tag_aliases", nil)
+	} else {
+		saveConfigKey("tag_aliases", aliases)
+	}
+}
+
+// printTagAliases prints each tag with aliases, sorted, followed by
+// its aliases.
+func printTagAliases(aliases map[string][]string) {
+	if len(aliases) == 0 {
+		fmt.Printf("No tag aliases.\n")
+		return
+	}
+
+	var tags []string
+	for tag := range aliases {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	for _, tag := range tags {
+		fmt.Printf("%v: %v\n", tag, strings.Join(aliases[tag], ", "))
+	}
+}
+
+// addTagAliases adds the given aliases to the given tag in the given
+// map. An alias of another tag is moved to this one. A tag with its
+// own aliases can't become an alias, and an alias can't have aliases.
+func addTagAliases(aliases map[string][]string, tag string, names []string) error {
+	if tag == "" {
+		return fmt.Errorf("An empty tag can't have aliases.")
+	}
+	if canon := findCanonicalTag(aliases, tag); canon != tag {
+		return fmt.Errorf("`%v` is an alias of `%v`.", tag, canon)
+	}
+
+	for _, name := range names {
+		if _, in := aliases[name]; in {
+			return fmt.Errorf("`%v` has its own aliases.", name)
+		}
+	}
+
+	removeTagAliases(aliases, names)
+	for _, name := range names {
+		if name != "" && name != tag {
+			aliases[tag] = mergeTags(aliases[tag], []string{name})
+		}
+	}
+
+	return nil
+}
+
+// removeTagAliases removes the given names from the given map. A name
+// that's an alias is removed from its tag, and a name that's a tag
+// has all its aliases removed. It returns the number removed.
+func removeTagAliases(aliases map[string][]string, names []string) int {
+	count := 0
+
+	for _, name := range names {
+		if list, in := aliases[name]; in {
+			count += len(list)
+			delete(aliases, name)
+			continue
+		}
+
+		for tag, list := range aliases {
+			kept := removeTags(list, []string{name})
+			if len(kept) < len(list) {
+				count += 1
+				if len(kept) == 0 {
+					delete(aliases, tag)
+				} else {
+					aliases[tag] = kept
+				}
+			}
+		}
+	}
+
+	return count
+}
+
+// findCanonicalTag returns the tag that the given tag is an alias of,
+// or the given tag if it isn't an alias. Aliases cover children, so
+// with `kubernetes` aliased as `k8s`, `k8s/pods` is `kubernetes/pods`.
+// The closest alias wins.
+func findCanonicalTag(aliases map[string][]string, tag string) string {
+	found := tag
+	best := 0
+
+	for canon, list := range aliases {
+		for _, alias := range list {
+			if isTagUnder(tag, alias) && len(alias) > best {
+				found = moveTag(tag, alias, canon)
+				best = len(alias)
+			}
+		}
+	}
+
+	return found
+}
+
+// expandTagAliases returns the given tag, as canonicalized, and each
+// of its aliases.
+func expandTagAliases(aliases map[string][]string, tag string) []string {
+	canon := findCanonicalTag(aliases, tag)
+	group := []string{canon}
+	best := 0
+
+	for parent, list := range aliases {
+		if isTagUnder(canon, parent) && len(parent) > best {
+			group = []string{canon}
+			for _, alias := range list {
+				group = append(group, moveTag(canon, parent, alias))
+			}
+			best = len(parent)
+		}
+	}
+
+	return group
+}
+
+// canonicalizeTags returns the given tags with each alias replaced
+// by the tag it's an alias of. Repeats are removed and the order is
+// kept.
+func canonicalizeTags(aliases map[string][]string, tags []string) []string {
+	var clean []string
+	ref := make(map[string]bool)
+
+	for _, tag := range tags {
+		canon := findCanonicalTag(aliases, tag)
+		if !ref[canon] {
+			clean = append(clean, canon)
+			ref[canon] = true
+		}
+	}
+
+	return clean
+}
+
+// canonicalizeRecordTags replaces the aliases in the tags of each of
+// the given Records, if the config says to.
+func canonicalizeRecordTags(conf *Config, records []Record) {
+	if !conf.CanonicalizeTags {
+		return
+	}
+
+	for o := range records {
+		records[o].Tags = canonicalizeTags(conf.TagAliases, records[o].Tags)
+	}
+}
@@ -7,6 +7,23 @@ import (
 )
 
 
+// ValueOptions maps the command-line options that take a value,
+// in their short and long forms, to their long forms. Short forms
+// here are case-sensitive, unlike other short-form options.
+var ValueOptions = map[string]string{
+	"P": "pipe-to",
+	"attr": "attr",
+	"bulk": "bulk",
+	"bulk-format": "bulk-format",
+	"expires": "expires",
+	"note": "note",
+	"pipe-mode": "pipe-mode",
+	"pipe-to": "pipe-to",
+	"tag-add": "tag-add",
+	"tag-remove": "tag-remove",
+}
+
+
 // parseArgs receives the command line arguments and returns two
 // useful interpretations of those arguments: an ActionCode and a
 // slice of strings that, if present, will affect the action (as
@@ -15,6 +32,18 @@ func parseArgs(args []string) (*ActionCode, []string) {
 	act := defaultActionCode()
 	var strs []string
 
+	// nextValue returns the argument following the one at `o`, which
+	// is the value of the option at `o`, and the new index. If there
+	// is no following argument, there's nothing to do, so it exits.
+	nextValue := func(o int, opt string) (string, int) {
+		if o + 1 < len(args) {
+			return args[o + 1], o + 1
+		}
+		fmt.Fprintf(os.Stderr, "Option `%v` needs a value.\n", opt)
+		os.Exit(1)
+		return "", o
+	}
+
 out:
 	for o := 0; o < len(args); o++ {
 		// Command options start with dashes.
@@ -22,13 +51,29 @@ out:
 			arg := strings.ToLower(args[o])
 
 			if arg[1] == '-' {  // Long-form options start with two.
-				arg = strings.Replace(arg, string('-'), "", -1)
-				updateActionCodeFromWord(arg, act)
+				arg = strings.TrimLeft(arg, "-")
+
+				if eq := strings.Index(arg, "="); eq > -1 {  // As in `--pipe-to=cat`.
+					raw := strings.TrimLeft(args[o], "-")
+					updateActionCodeFromValue(arg[:eq], raw[(eq + 1):], act)
+				} else if _, in := ValueOptions[arg]; in {
+					var val string
+					val, o = nextValue(o, args[o])
+					updateActionCodeFromValue(arg, val, act)
+				} else {
+					updateActionCodeFromWord(arg, act)
+				}
 			} else {  // Short-form options start with one.
-				arg = strings.Replace(arg, string('-'), "", -1)
-				for i := 0; i < len(arg); i++ {
-					char := string(arg[i])
-					updateActionCodeFromChar(char, act)
+				raw := strings.TrimLeft(args[o], "-")
+				for i := 0; i < len(raw); i++ {
+					char := string(raw[i])
+					if _, in := ValueOptions[char]; in {
+						var val string
+						val, o = nextValue(o, "-" + char)
+						updateActionCodeFromValue(char, val, act)
+					} else {
+						updateActionCodeFromChar(strings.ToLower(char), act)
+					}
 				}
 			}
 		} else {
@@ -42,6 +87,44 @@ out:
 	return act, strs
 }
 
+// updateActionCodeFromValue receives the name of an option that
+// takes a value (in either form), the value, and a pointer to an
+// ActionCode, and it sets some value in that ActionCode according
+// to the option.
+func updateActionCodeFromValue(opt string, val string, act *ActionCode) {
+	switch {
+	case ValueOptions[opt] == "attr":  // an attribute for a new entry
+		act.Attrs = append(act.Attrs, val)
+	case ValueOptions[opt] == "bulk":  // create from a file
+		act.Main = MainActCreate
+		act.Bulk = val
+	case ValueOptions[opt] == "bulk-format":
+		act.BulkFormat = val
+	case ValueOptions[opt] == "expires":  // an expiry for a new entry
+		act.Attrs = append(act.Attrs, ExpiresAttr + AttrSeparator + val)
+	case ValueOptions[opt] == "note":  // a note for a new entry
+		act.Note = val
+	case ValueOptions[opt] == "pipe-mode":
+		act.PipeMode = val
+	case ValueOptions[opt] == "pipe-to":  // select, pipe to the given tool
+		act.Main = MainActView
+		act.Sub = SubActPipe
+		act.PipeTo = val
+	case ValueOptions[opt] == "tag-add":  // select, add tags
+		act.Main = MainActView
+		act.Sub = SubActTag
+		act.TagOp = "add"
+		act.TagArgs = val
+	case ValueOptions[opt] == "tag-remove":  // select, remove tags
+		act.Main = MainActView
+		act.Sub = SubActTag
+		act.TagOp = "remove"
+		act.TagArgs = val
+	default:
+		fmt.Fprintf(os.Stderr, "Unrecognized option `%v`", opt)
+	}
+}
+
 // updateActionCodeFromChar receives a string, being a short-form
 // command-line option, and a pointer to an ActionCode, and it sets
 // some value in that ActionCode according to the string.
@@ -51,11 +134,16 @@ func updateActionCodeFromChar(arg string, act *ActionCode) {
 		act.Print = PrintCompact
 	case arg == "2":  // print full otuput
 		act.Print = PrintFull
+	case arg == "3":  // print full otuput with notes
+		act.Print = PrintVerbose
 	case arg == "a":  // ascending order
 		act.Sort = SortAsc
 	case arg == "b":  // browse (print only, no select)
 		act.Main = MainActView
 		act.Sub = SubActView
+	case arg == "c":  // select, copy
+		act.Main = MainActView
+		act.Sub = SubActCopy
 	case arg == "d":  // descending order
 		act.Sort = SortDesc
 	case arg == "e":  // select, edit
@@ -76,6 +164,8 @@ func updateActionCodeFromChar(arg string, act *ActionCode) {
 		act.Sub = SubActPipe
 	case arg == "s":  // match strict
 		act.Match = MatchStrict
+	case arg == "t":  // list tags
+		act.Main = MainActTags
 	case arg == "v":  // view values
 		act.Print = PrintValsOnly
 	case arg == "x":  // select, delete
@@ -90,38 +180,104 @@ func updateActionCodeFromChar(arg string, act *ActionCode) {
 // except it acts on long-form options.
 func updateActionCodeFromWord(arg string, act *ActionCode) {
 	switch {
+	case arg == "alias":
+		act.Main = MainActAliases
+		act.TagOp = "alias"
+	case arg == "aliases":
+		act.Main = MainActAliases
 	case arg == "asc":
 		act.Sort = SortAsc
+	case arg == "backups":
+		act.Main = MainActBackups
 	case arg == "browse":
 		act.Main = MainActView
 		act.Sub = SubActView
+	case arg == "check":
+		act.Main = MainActCheck
+	case arg == "clear-clipboard":  // Internal, for clearing after `copy`.
+		act.Main = MainActClearClipboard
+	case arg == "copy":
+		act.Main = MainActView
+		act.Sub = SubActCopy
 	case arg == "desc":
 		act.Sort = SortDesc
+	case arg == "dedupe":
+		act.Main = MainActDedupe
 	case arg == "delete":
 		act.Main = MainActView
 		act.Sub = SubActDelete
 	case arg == "demo":  // Demo.  #TODO
 		act.Main = MainActDemo
+	case arg == "empty-trash":
+		act.Main = MainActEmptyTrash
 	case arg == "edit":
 		act.Main = MainActView
 		act.Sub = SubActEdit
+	case arg == "drop-tag":
+		act.Main = MainActRetag
+		act.TagOp = "drop"
+	case arg == "editor":  // Read a new value from the editor.
+		act.ValueFrom = ValueFromEditor
+	case arg == "force":  // Create even if the value exists.
+		act.Force = true
+	case arg == "gc":
+		act.Main = MainActGC
 	case arg == "help":
 		act.Main = MainActHelp
+	case arg == "history":
+		act.Main = MainActHistory
+	case arg == "include-expired":
+		act.IncludeExpired = true
 	case arg == "init":
 		act.Main = MainActInit
 	case arg == "loose":
 		act.Match = MatchLoose
+	case arg == "merge-tags":
+		act.Main = MainActRetag
+		act.TagOp = "merge"
 	case arg == "new":
 		act.Main = MainActCreate
+	case arg == "no-confirm":
+		act.NoConfirm = true
 	case arg == "one-line":
 		act.Print = PrintCompact
 	case arg == "pipe":
 		act.Main = MainActView
 		act.Sub = SubActPipe
+	case arg == "pin":
+		act.Main = MainActView
+		act.Sub = SubActPin
+	case arg == "redo":
+		act.Main = MainActRedo
+	case arg == "repair":
+		act.Main = MainActRepair
+	case arg == "restore":
+		act.Main = MainActRestore
+	case arg == "restore-backup":
+		act.Main = MainActRestoreBackup
+	case arg == "retag":
+		act.Main = MainActRetag
+		act.TagOp = "rename"
+	case arg == "stdin":  // Read a new value from stdin.
+		act.ValueFrom = ValueFromStdin
 	case arg == "strict":
 		act.Match = MatchStrict
+	case arg == "tags":
+		act.Main = MainActTags
+	case arg == "three-line":
+		act.Print = PrintVerbose
+	case arg == "trash":
+		act.Main = MainActTrash
 	case arg == "two-line":
 		act.Print = PrintFull
+	case arg == "unalias":
+		act.Main = MainActAliases
+		act.TagOp = "unalias"
+	case arg == "undo":
+		act.Main = MainActUndo
+	case arg == "unpin":
+		act.Main = MainActView
+		act.Sub = SubActUnpin
 	case arg == "vals-only":
 		act.Print = PrintValsOnly
 	default:
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+
+// AttrSeparator separates an attribute's key from its value, as in
+// `lang=go`.
+const AttrSeparator = "="
+
+// AttrTermPrefix marks a search term that matches attributes rather
+// than text. A term like `attr:lang=go` matches records whose `lang`
+// is `go`, and a term like `attr:lang` matches records with any
+// `lang`.
+const AttrTermPrefix = "attr:"
+
+
+// parseAttr splits the given attribute into its key and value, with
+// whitespace trimmed. It returns an error if the key is missing or
+// either part can't be saved in an entry.
+func parseAttr(attr string) (string, string, error) {
+	parts := strings.SplitN(attr, AttrSeparator, 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("`%v` isn't a key=value attribute", strings.TrimSpace(attr))
+	}
+
+	key, val := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	switch {
+	case key == "":
+		return "", "", fmt.Errorf("`%v` has no key", strings.TrimSpace(attr))
+	case strings.ContainsAny(key, ", \t\n") || hasSeparators(key):
+		return "", "", fmt.Errorf("the key `%v` can't contain commas, spaces, or ASCII separators", key)
+	case strings.Contains(val, "\n") || hasSeparators(val):
+		return "", "", fmt.Errorf("the value of `%v` can't contain line breaks or ASCII separators", key)
+	}
+
+	return key, val, nil
+}
+
+// cleanAttrs checks each of the given attributes and returns them
+// sorted by key. If a key is repeated, the last one wins. Empty
+// strings are skipped. Expiries are saved as dates, so spans of time
+// like `7d` are changed to the date they end on.
+func cleanAttrs(attrs []string) ([]string, error) {
+	ref := make(map[string]string)
+
+	for _, attr := range attrs {
+		if strings.TrimSpace(attr) == "" {
+			continue
+		}
+		key, val, err := parseAttr(attr)
+		if err == nil && key == ExpiresAttr {
+			val, err = cleanExpiry(val)
+		}
+		if err != nil {
+			return nil, err
+		}
+		ref[key] = val
+	}
+
+	return makeAttrsFromMap(ref), nil
+}
+
+// parseAttrList transforms the comma-separated list of attributes
+// from the text edit file into a slice of attributes. Since values
+// can contain commas, a part without a key is joined to the one
+// before it.
+func parseAttrList(input string) ([]string, error) {
+	var attrs []string
+
+	for _, part := range strings.Split(input, ",") {
+		if len(attrs) > 0 && !strings.Contains(part, AttrSeparator) {
+			attrs[len(attrs) - 1] += "," + part
+		} else {
+			attrs = append(attrs, part)
+		}
+	}
+
+	return cleanAttrs(attrs)
+}
+
+// mergeAttrs returns the attributes in `a` and `b`, sorted by key.
+// Where both have a key, the value in `b` wins.
+func mergeAttrs(a []string, b []string) []string {
+	merged, err := cleanAttrs(append(append([]string{}, a...), b...))
+	if err != nil {
+		return a
+	}
+	return merged
+}
+
+// makeAttrMap transforms the given attributes into a map of keys to
+// values. Malformed attributes are skipped.
+func makeAttrMap(attrs []string) map[string]string {
+	ref := make(map[string]string)
+
+	for _, attr := range attrs {
+		if key, val, err := parseAttr(attr); err == nil {
+			ref[key] = val
+		}
+	}
+
+	return ref
+}
+
+// makeAttrsFromMap is the reverse of `makeAttrMap`. The attributes
+// are sorted by key. An empty map gives a nil slice.
+func makeAttrsFromMap(ref map[string]string) []string {
+	var attrs []string
+
+	for key, val := range ref {
+		attrs = append(attrs, key + AttrSeparator + val)
+	}
+	sort.Strings(attrs)
+
+	return attrs
+}
+
+// countAttrMatches returns 1 if the given attributes match the given
+// query, which is a key and value joined by the attribute separator
+// or just a key, and 0 if they don't.
+func countAttrMatches(attrs []string, query string) int {
+	parts := strings.SplitN(query, AttrSeparator, 2)
+	val, in := makeAttrMap(attrs)[strings.TrimSpace(parts[0])]
+
+	if in && (len(parts) == 1 || val == strings.TrimSpace(parts[1])) {
+		return 1
+	}
+	return 0
+}
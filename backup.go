@@ -0,0 +1,233 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+// BackupFile is a structure that describes one backup of the store:
+// the path to it, when it was made, and whether it's gzipped.
+type BackupFile struct {
+	Path string
+	Time time.Time
+	Gzipped bool
+}
+
+// BackupTimeFormat is the format of the time in a backup's name,
+// which follows the store's name, as in `store.20251201-093000.000`.
+const BackupTimeFormat = "20060102-150405.000"
+
+// BackupGzipExtension is added to the names of gzipped backups.
+const BackupGzipExtension = ".gz"
+
+
+// makeBackupLister returns the Backups main action function, which
+// prints the backups of the store, newest first, numbered as they
+// can be given to `--restore-backup`.
+func makeBackupLister(conf *Config) func() {
+	lister := func() {
+		backups := readBackupFiles(conf)
+		if len(backups) == 0 {
+			fmt.Printf("There are no backups in %v.\n", conf.BackupDir)
+			return
+		}
+
+		n := len(strconv.Itoa(len(backups)))
+		for o, backup := range backups {
+			var size int64
+			if info, err := os.Stat(backup.Path); err == nil {
+				size = info.Size()
+			}
+			gzipped := ""
+			if backup.Gzipped {
+				gzipped = ", gzipped"
+			}
+			fmt.Printf("%*d) %v (%v bytes%v)\n", n, (o + 1), backup.Time.Format("2006-01-02 15:04:05"), size, gzipped)
+		}
+	}
+
+	return lister
+}
+
+// makeBackupRestorer returns the Restore Backup main action function,
+// which replaces the store with the backup numbered by the first of
+// the given terms, as listed by `--backups`. Unless the action code
+// says not to confirm, the user is asked first. The store is backed
+// up before it's replaced, so the restore can be reverted too.
+func makeBackupRestorer(conf *Config, act *ActionCode, terms []string) func() {
+	restorer := func() {
+		backups := readBackupFiles(conf)
+
+		var n int
+		var err error
+		if len(terms) > 0 {
+			n, err = strconv.Atoi(terms[0])
+		}
+		if len(terms) == 0 || err != nil || n < 1 || n > len(backups) {
+			fmt.Fprintf(os.Stderr, "To restore a backup, give its number, as listed by --backups:\n  $ star --restore-backup 1\n")
+			return
+		}
+		backup := backups[n - 1]
+
+		fmt.Printf("Will replace the store with the backup from %v.\n", backup.Time.Format("2006-01-02 15:04:05"))
+		if !act.NoConfirm && promptForChoice("Continue? (y/N) ", []string{"yes", "no"}, "no") != "yes" {
+			fmt.Printf("No changes saved.\n")
+			return
+		}
+
+		// The backup is read before the store is backed up, since the
+		// rotation might gzip or remove it.
+		cont := readBackupFile(backup)
+		backupStoreFile(conf)
+		writeStoreFile(conf.Store, cont)
+		fmt.Printf("Restored the backup.\n")
+	}
+
+	return restorer
+}
+
+// updateStore updates the user's store file with `updateStoreFile`,
+// after backing it up. If it's in an older version, it's migrated
+// first, which backs it up too.
+func updateStore(conf *Config, bkMaker func(*os.File, Record)) {
+	if !migrateStoreFile(conf) {
+		backupStoreFile(conf)
+	}
+	updateStoreFile(conf.Store, bkMaker)
+}
+
+// backupStoreFile copies the user's store file, as it is, into the
+// backup directory, then rotates the backups. If there's no backup
+// directory, there's no backup.
+func backupStoreFile(conf *Config) {
+	if conf.BackupDir == "" || !doesFileExist(conf.Store) {
+		return
+	}
+	checkForError(os.MkdirAll(conf.BackupDir, 0700))
+
+	cont, err := ioutil.ReadFile(conf.Store)
+	checkForError(err)
+
+	bk_name := path.Join(conf.BackupDir, path.Base(conf.Store) + "." + time.Now().Format(BackupTimeFormat))
+	checkForError(ioutil.WriteFile(bk_name, cont, 0600))
+
+	rotateBackups(conf)
+}
+
+// rotateBackups removes the backups that are no longer wanted: the
+// most recent `backup_count` are kept, along with the most recent
+// one from each of the last `backup_days` days. The kept backups are
+// gzipped, except for the most recent.
+func rotateBackups(conf *Config) {
+	backups := readBackupFiles(conf)
+	days := make(map[string]bool)
+	cutoff := time.Now().AddDate(0, 0, -conf.BackupDays)
+
+	for o, backup := range backups {
+		day := backup.Time.Format(ExpiresDateFormat)
+		keep := o < conf.BackupCount
+		if !days[day] && backup.Time.After(cutoff) {
+			days[day] = true
+			keep = true
+		}
+
+		switch {
+		case !keep:
+			checkForError(os.Remove(backup.Path))
+		case o > 0 && !backup.Gzipped:
+			gzipBackupFile(backup)
+		}
+	}
+}
+
+// readBackupFiles returns the backups of the user's store file in the
+// backup directory, newest first.
+func readBackupFiles(conf *Config) []BackupFile {
+	files, err := ioutil.ReadDir(conf.BackupDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	checkForError(err)
+
+	prefix := path.Base(conf.Store) + "."
+	var backups []BackupFile
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), BackupGzipExtension)
+		when, err := time.ParseInLocation(BackupTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, BackupFile{path.Join(conf.BackupDir, name), when, strings.HasSuffix(name, BackupGzipExtension)})
+	}
+
+	sort.SliceStable(backups, func(a, b int) bool {
+		return backups[a].Time.After(backups[b].Time)
+	})
+
+	return backups
+}
+
+// readBackupFile returns the contents of the given backup, which is
+// decompressed if it's gzipped.
+func readBackupFile(backup BackupFile) []byte {
+	file, err := os.Open(backup.Path)
+	checkForError(err)
+	defer file.Close()
+
+	var reader io.Reader = file
+	if backup.Gzipped {
+		gz, err := gzip.NewReader(file)
+		checkForError(err)
+		defer gz.Close()
+		reader = gz
+	}
+
+	cont, err := ioutil.ReadAll(reader)
+	checkForError(err)
+
+	return cont
+}
+
+// gzipBackupFile replaces the given backup with a gzipped copy.
+func gzipBackupFile(backup BackupFile) {
+	cont := readBackupFile(backup)
+
+	gz_name := backup.Path + BackupGzipExtension
+	file, err := os.OpenFile(gz_name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	checkForError(err)
+
+	gz := gzip.NewWriter(file)
+	_, err = gz.Write(cont)
+	checkForError(err)
+	checkForError(gz.Close())
+	checkForError(file.Close())
+
+	checkForError(os.Remove(backup.Path))
+}
+
+// writeStoreFile replaces the store file named by the given string
+// with the given contents. Like in `updateStoreFile`, the store is
+// locked, and the new file is renamed over the old.
+func writeStoreFile(file_name string, cont []byte) {
+	unlock := lockFile(file_name)
+	defer unlock()
+
+	bk_name := file_name + "_bk_" + strconv.FormatInt(time.Now().Unix(), 10)
+	checkForError(ioutil.WriteFile(bk_name, cont, 0644))
+	checkForError(os.Rename(bk_name, file_name))
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+// StoreEntry is a structure that holds one entry as read from the
+// store file, before it's parsed: its text, without the group
+// separator, its byte offset in the file, and whether it was ended
+// by a group separator.
+type StoreEntry struct {
+	Text string
+	Offset int64
+	Ended bool
+}
+
+// StoreProblem is a structure that describes something wrong with an
+// entry in the store file: the entry's byte offset, a message, and
+// whether `--repair` can fix it or must quarantine the entry.
+type StoreProblem struct {
+	Offset int64
+	Message string
+	Fixable bool
+}
+
+
+// quarantineFilePath returns the path to the file that `--repair`
+// moves unfixable entries to, for the store file named by the given
+// string. It's kept next to the store.
+func quarantineFilePath(store string) string {
+	return store + ".quarantine"
+}
+
+// makeChecker returns the Check main action function, which scans the
+// store file and reports each problem it finds, with the byte offset
+// of the entry it's in.
+func makeChecker(conf *Config) func() {
+	checker := func() {
+		entries := readStoreEntries(conf.Store)
+		problems, _, _ := checkStoreEntries(entries)
+
+		for _, problem := range problems {
+			fmt.Printf("offset %v: %v\n", problem.Offset, problem.Message)
+		}
+
+		if len(problems) == 0 {
+			fmt.Printf("Checked %v: no problems found.\n", pluralize(len(entries), "entry", "entries"))
+		} else {
+			fmt.Printf("Checked %v: found %v. Run `star --repair` to fix them.\n", pluralize(len(entries), "entry", "entries"), pluralize(len(problems), "problem", "problems"))
+		}
+	}
+
+	return checker
+}
+
+// makeRepairer returns the Repair main action function, which fixes
+// the problems in the store file that can be fixed and moves the
+// entries that can't to the quarantine file. The problems are shown
+// first and, unless the action code says not to confirm, the user is
+// asked before the store is changed. The store is backed up first.
+func makeRepairer(conf *Config, act *ActionCode) func() {
+	repairer := func() {
+		entries := readStoreEntries(conf.Store)
+		problems, records, quarantined := checkStoreEntries(entries)
+
+		if len(problems) == 0 {
+			fmt.Printf("Checked %v: no problems found.\n", pluralize(len(entries), "entry", "entries"))
+			return
+		}
+
+		for _, problem := range problems {
+			action := "will fix"
+			if !problem.Fixable {
+				action = "will quarantine"
+			}
+			fmt.Printf("offset %v: %v (%v)\n", problem.Offset, problem.Message, action)
+		}
+
+		if !act.NoConfirm && promptForChoice("Continue? (y/N) ", []string{"yes", "no"}, "no") != "yes" {
+			fmt.Printf("No changes saved.\n")
+			return
+		}
+
+		// The quarantine is written first, so if that fails, nothing is
+		// lost from the store.
+		if len(quarantined) > 0 {
+			file, err := os.OpenFile(quarantineFilePath(conf.Store), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+			checkForError(err)
+			for _, entry := range quarantined {
+				_, err = file.WriteString(entry.Text + string(GroupSeparator) + "\n")
+				checkForError(err)
+			}
+			checkForError(file.Close())
+		}
+
+		lines := []string{makeStoreHeader(StoreFormatVersion)}
+		for _, record := range records {
+			lines = append(lines, joinRecord(record))
+		}
+
+		backupStoreFile(conf)
+		writeStoreFile(conf.Store, []byte(strings.Join(lines, "")))
+
+		fmt.Printf("Repaired the store.\n")
+		if len(quarantined) > 0 {
+			fmt.Printf("Moved %v to %v.\n", pluralize(len(quarantined), "entry", "entries"), quarantineFilePath(conf.Store))
+		}
+	}
+
+	return repairer
+}
+
+// checkStoreEntries checks each of the given entries and returns the
+// problems found, the Records as they'd be once repaired, and the
+// entries that can't be repaired. Entries that duplicate an earlier
+// entry's value and tags are merged into it.
+func checkStoreEntries(entries []StoreEntry) ([]StoreProblem, []Record, []StoreEntry) {
+	var problems []StoreProblem
+	var records []Record
+	var quarantined []StoreEntry
+	var offsets []int64
+
+	for _, entry := range entries {
+		if strings.TrimSpace(entry.Text) == "" {
+			problems = append(problems, StoreProblem{entry.Offset, "is a stray group separator", true})
+			continue
+		}
+
+		record, found, ok := checkStoreEntry(entry)
+		problems = append(problems, found...)
+		if !ok {
+			quarantined = append(quarantined, entry)
+			continue
+		}
+
+		if n := findRecordIndex(records, record); n >= 0 {
+			problems = append(problems, StoreProblem{entry.Offset, fmt.Sprintf("duplicates the value and tags of the entry at offset %v", offsets[n]), true})
+			records[n] = mergeRecords([]Record{records[n], record}, 0)
+			continue
+		}
+
+		records = append(records, record)
+		offsets = append(offsets, entry.Offset)
+	}
+
+	return problems, records, quarantined
+}
+
+// checkStoreEntry checks the given entry and returns it as a Record,
+// repaired if need be, the problems found, and a bool that will be
+// false if the entry can't be repaired.
+func checkStoreEntry(entry StoreEntry) (Record, []StoreProblem, bool) {
+	var problems []StoreProblem
+	problem := func(fixable bool, format string, args ...interface{}) {
+		problems = append(problems, StoreProblem{entry.Offset, fmt.Sprintf(format, args...), fixable})
+	}
+
+	parts := splitEntry(entry.Text)
+	if !doesEntryHaveParts(parts) {
+		if len(parts) > 5 {
+			problem(false, "has %v stray record separators", len(parts) - 5)
+		} else {
+			problem(false, "is missing parts: it has %v of at least 3", len(parts))
+		}
+		return Record{}, problems, false
+	}
+
+	if !entry.Ended {
+		problem(true, "isn't ended by a group separator")
+	}
+
+	record := makeRecordFromParts(parts)
+
+	if strings.TrimSpace(record.Value) == "" {
+		problem(false, "has an empty value")
+		return record, problems, false
+	}
+
+	if hasSeparators(record.Value) {
+		problem(true, "has stray separators in its value")
+		record.Value = removeSeparators(record.Value)
+	}
+	if hasSeparators(record.Note) {
+		problem(true, "has stray separators in its note")
+		record.Note = removeSeparators(record.Note)
+	}
+
+	if meta, ok := checkRecordMeta(record.Meta); !ok {
+		problem(true, "has invalid metadata: %v", strings.Join(record.Meta, ", "))
+		record.Meta = meta
+	}
+
+	var attrs []string
+	for _, attr := range record.Attrs {
+		if _, _, err := parseAttr(attr); err != nil {
+			problem(true, "has an invalid attribute: %v", err)
+		} else {
+			attrs = append(attrs, attr)
+		}
+	}
+	record.Attrs = attrs
+
+	return record, problems, true
+}
+
+// checkRecordMeta checks the given Record metadata: there should be a
+// created time, an accessed time, and an access count, all integers,
+// and maybe the pinned mark. If it's valid, it's returned with true.
+// If not, the parts that can be read are returned with false, the
+// rest as zero, and the created time as now if it can't be read.
+func checkRecordMeta(meta []string) ([]string, bool) {
+	ok := len(meta) == 3 || (len(meta) == 4 && meta[3] == MetaPinned)
+	for o := 0; ok && o < 3; o++ {
+		if _, err := strconv.ParseInt(meta[o], 10, 64); err != nil {
+			ok = false
+		}
+	}
+	if ok {
+		return meta, true
+	}
+
+	created, accessed, count := parseRecordMeta(meta)
+	if created <= 0 {
+		created = time.Now().Unix()
+	}
+
+	fixed := formatRecordMeta(created, accessed, count)
+	if len(meta) > 3 && meta[3] == MetaPinned {
+		fixed = append(fixed, MetaPinned)
+	}
+
+	return fixed, false
+}
+
+// removeSeparators returns the given string without any separator
+// characters.
+func removeSeparators(str string) string {
+	return strings.NewReplacer(string(GroupSeparator), "", string(RecordSeparator), "", string(UnitSeparator), "").Replace(str)
+}
+
+// readStoreEntries reads the store file named by the given string and
+// returns each entry in it, with its byte offset. Unlike
+// `forEachRecordInFile`, entries that aren't well-formed are kept, so
+// they can be checked. Entries that are only blank space, and the
+// header, are skipped.
+func readStoreEntries(file_name string) []StoreEntry {
+	file, err := os.Open(file_name)
+	checkForError(err)
+	defer file.Close()
+
+	var entries []StoreEntry
+	var offset int64
+	reader := bufio.NewReader(file)
+
+	for {
+		raw, err := reader.ReadBytes(GroupSeparator)
+		text := string(raw)
+		ended := strings.HasSuffix(text, string(GroupSeparator))
+
+		if version, ok := parseStoreHeader(text); offset == 0 && ok {
+			_, err := getStoreFormatReader(version)
+			checkForError(err)
+		} else if strings.TrimSpace(text) != "" {
+			entries = append(entries, StoreEntry{strings.TrimSuffix(text, string(GroupSeparator)), offset, ended})
+		}
+
+		offset += int64(len(raw))
+		if err != nil {
+			break
+		}
+		offset += int64(skipLineBreak(reader))
+	}
+
+	return entries
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+// ClipboardBackend is a structure that describes a way of getting
+// text into and out of the system clipboard. Copy and Paste are
+// command lines that read from stdin and write to stdout. Backends
+// without a Paste command can't be read from.
+type ClipboardBackend struct {
+	Name string
+	Copy string
+	Paste string
+}
+
+// ClipboardOSC52 is the name of the backend that uses the OSC 52
+// terminal escape sequence rather than an external tool. That works
+// over SSH, as long as the terminal supports it.
+const ClipboardOSC52 = "osc52"
+
+// ClipboardBackends lists the known backends in the order that they
+// will be checked for.
+var ClipboardBackends = []ClipboardBackend{
+	{"wl-copy", "wl-copy", "wl-paste --no-newline"},
+	{"xclip", "xclip -selection clipboard", "xclip -selection clipboard -o"},
+	{"xsel", "xsel --clipboard --input", "xsel --clipboard --output"},
+	{"pbcopy", "pbcopy", "pbpaste"},
+	{ClipboardOSC52, "", ""},
+}
+
+
+// makeRecordCopier makes the Copy search action function: the
+// returned function will receive the slice of wanted Records and
+// copy their values, joined by newlines, to the clipboard. If the
+// config says to, the clipboard will be cleared after some seconds.
+// It returns the Records that were copied.
+func makeRecordCopier(conf *Config) func([]Record) []Record {
+	copier := func(records []Record) []Record {
+		backend, ok := findClipboardBackend(conf.Clipboard)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown clipboard backend `%v`.\n", conf.Clipboard)
+			return nil
+		}
+
+		values := make([]string, len(records))
+		for o, record := range records {
+			values[o] = record.Value
+		}
+		value := strings.Join(values, "\n")
+
+		if err := copyToClipboard(backend, value); err != nil {
+			return nil
+		}
+
+		if conf.ClipboardClear > 0 {
+			scheduleClipboardClear(backend, value, conf.ClipboardClear)
+		}
+		return records
+	}
+
+	return copier
+}
+
+// findClipboardBackend returns the backend with the given name. If
+// the name is "auto", the first backend that's usable in the current
+// environment will be returned.
+func findClipboardBackend(name string) (ClipboardBackend, bool) {
+	if name == "auto" {
+		return detectClipboardBackend(), true
+	}
+
+	for _, backend := range ClipboardBackends {
+		if backend.Name == name {
+			return backend, true
+		}
+	}
+
+	return ClipboardBackend{}, false
+}
+
+// detectClipboardBackend checks the environment for a display and
+// the PATH for clipboard tools. In an SSH session without a display,
+// or if no tools are found, the OSC 52 backend will be used.
+func detectClipboardBackend() ClipboardBackend {
+	has_wayland := os.Getenv("WAYLAND_DISPLAY") != ""
+	has_x := os.Getenv("DISPLAY") != ""
+	in_ssh := os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != ""
+
+	for _, backend := range ClipboardBackends {
+		switch {
+		case backend.Name == ClipboardOSC52:
+			return backend
+		case in_ssh && !has_wayland && !has_x:
+			continue
+		case backend.Name == "wl-copy" && !has_wayland:
+			continue
+		case (backend.Name == "xclip" || backend.Name == "xsel") && !has_x:
+			continue
+		}
+
+		if _, err := exec.LookPath(splitCommandLine(backend.Copy)[0]); err == nil {
+			return backend
+		}
+	}
+
+	return ClipboardBackends[len(ClipboardBackends) - 1]
+}
+
+// copyToClipboard puts the given string on the clipboard through the
+// given backend. The tool's stderr isn't kept because some of them
+// (like xclip) stay running in the background to serve the value.
+func copyToClipboard(backend ClipboardBackend, value string) error {
+	if backend.Name == ClipboardOSC52 {
+		return writeOSC52(value)
+	}
+
+	err := runTool(splitCommandLine(backend.Copy), strings.NewReader(value), 0, false)
+	if err != nil {
+		printToolError(err)
+	}
+
+	return err
+}
+
+// readClipboard returns the clipboard's contents as read through the
+// given backend. If the backend can't be read from, an error will be
+// returned.
+func readClipboard(backend ClipboardBackend) (string, error) {
+	if backend.Paste == "" {
+		return "", fmt.Errorf("the %v clipboard can't be read", backend.Name)
+	}
+
+	args := splitCommandLine(backend.Paste)
+	out, err := exec.Command(args[0], args[1:]...).Output()
+	return string(out), err
+}
+
+// writeOSC52 writes the OSC 52 escape sequence that sets the
+// clipboard to the given string. It's written to the terminal rather
+// than stdout so it works when stdout is redirected. Inside tmux, the
+// sequence is wrapped so that tmux passes it through.
+func writeOSC52(value string) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		tty = os.Stdout
+	} else {
+		defer tty.Close()
+	}
+
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(value)) + "\a"
+	if os.Getenv("TMUX") != "" {
+		seq = "\x1bPtmux;" + strings.Replace(seq, "\x1b", "\x1b\x1b", -1) + "\x1b\\"
+	}
+
+	_, err = tty.WriteString(seq)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing to the clipboard: %v\n", err)
+	}
+
+	return err
+}
+
+// scheduleClipboardClear starts a copy of this program in the
+// background that will clear the clipboard after the given number of
+// seconds. Only a hash of the copied value is passed along, so the
+// value doesn't show up in the process list.
+func scheduleClipboardClear(backend ClipboardBackend, value string, secs int) {
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Won't clear the clipboard: %v\n", err)
+		return
+	}
+
+	cmd := exec.Command(exe, "--clear-clipboard", strconv.Itoa(secs), backend.Name, hashValue(value))
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Won't clear the clipboard: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Clipboard will be cleared in %v seconds.\n", secs)
+}
+
+// makeClipboardClearer returns the main action function that runs in
+// the background after a copy. The terms should be the number of
+// seconds to wait, the backend's name, and the hash of the copied
+// value. The clipboard will only be cleared if it still contains
+// that value, unless the backend can't be read, in which case it
+// will be cleared anyway.
+func makeClipboardClearer(terms []string) func() {
+	clearer := func() {
+		if len(terms) < 3 {
+			return
+		}
+
+		secs, err := strconv.Atoi(terms[0])
+		if err != nil {
+			return
+		}
+
+		backend, ok := findClipboardBackend(terms[1])
+		if !ok {
+			return
+		}
+
+		time.Sleep(time.Duration(secs) * time.Second)
+
+		if current, err := readClipboard(backend); err == nil && hashValue(current) != terms[2] {
+			return
+		}
+
+		copyToClipboard(backend, "")
+	}
+
+	return clearer
+}
+
+// hashValue returns the hex-encoded SHA-256 hash of the given string.
+func hashValue(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/user"
 	"path"
+	"strconv"
 	"strings"
 	"gopkg.in/yaml.v2"
 )
@@ -16,16 +17,41 @@ import (
 // replaced by the values from the YAML file.
 type Config struct {
 	Action string `yaml:"pipe_to",omitempty`
+	ArchiveFile string `yaml:"archive_file,omitempty"`
+	BackupCount int `yaml:"backup_count,omitempty"`
+	BackupDays int `yaml:"backup_days,omitempty"`
+	BackupDir string `yaml:"backup_dir,omitempty"`
+	CanonicalizeTags bool `yaml:"canonicalize_tags,omitempty"`
+	Clipboard string `yaml:"clipboard,omitempty"`
+	ClipboardClear int `yaml:"clipboard_clear,omitempty"`
+	EditFormat string `yaml:"edit_format,omitempty"`
 	Editor string `yaml:"editor",omitempty`
 	FilterMode string `yaml:"filter_mode",omitempty`
+	IncludeExpired bool `yaml:"include_expired,omitempty"`
+	Normalizers []string `yaml:"normalizers,omitempty"`
+	OnDuplicate string `yaml:"on_duplicate,omitempty"`
+	PipeMode string `yaml:"pipe_mode,omitempty"`
+	PipeSeparator string `yaml:"pipe_separator,omitempty"`
+	PipeTimeout int `yaml:"pipe_timeout,omitempty"`
 	PrintLines string `yaml:"print_lines",omitempty`
+	SearchNotes bool `yaml:"search_notes,omitempty"`
 	SortOrder string `yaml:"sort_order",omitempty`
 	Store string `yaml:"store_file",omitempty`
+	TagAliases map[string][]string `yaml:"tag_aliases,omitempty"`
+	TrashDays int `yaml:"trash_days,omitempty"`
 }
 
 const ConfigFileName = "config.yaml"
+const DefaultBackupCount = 10
+const DefaultBackupDirName = "backups"
+const DefaultClipboard = "auto"
+const DefaultEditFormat = "text"
 const DefaultEditorPath = "/usr/bin/vi"
 const DefaultFilterMode = "loose"
+const DefaultOnDuplicate = "ask"
+const DefaultNormalizers = "whitespace"
+const DefaultPipeMode = "join"
+const DefaultPipeSeparator = "newline"
 const DefaultPrintLines = "2"
 const DefaultSortOrder = "desc"
 const DefaultStoreFileName = "store"
@@ -67,7 +93,31 @@ func readConfig() *Config {
 
 // defaultConfig returns a Config filled with defaults.
 func defaultConfig() *Config {
-	return &Config{"", getEnv("EDITOR", DefaultEditorPath), DefaultFilterMode, DefaultPrintLines, DefaultSortOrder, defaultStoreFilePath()}
+	return &Config{
+		Action: "",
+		ArchiveFile: archiveFilePath(defaultStoreFilePath()),
+		BackupCount: DefaultBackupCount,
+		BackupDays: 0,
+		BackupDir: backupDirPath(defaultStoreFilePath()),
+		CanonicalizeTags: false,
+		Clipboard: DefaultClipboard,
+		ClipboardClear: 0,
+		EditFormat: DefaultEditFormat,
+		Editor: getEnv("EDITOR", DefaultEditorPath),
+		FilterMode: DefaultFilterMode,
+		IncludeExpired: false,
+		Normalizers: strings.Split(DefaultNormalizers, ","),
+		OnDuplicate: DefaultOnDuplicate,
+		PipeMode: DefaultPipeMode,
+		PipeSeparator: DefaultPipeSeparator,
+		PipeTimeout: 0,
+		PrintLines: DefaultPrintLines,
+		SearchNotes: false,
+		SortOrder: DefaultSortOrder,
+		Store: defaultStoreFilePath(),
+		TagAliases: make(map[string][]string),
+		TrashDays: 0,
+	}
 }
 
 // mergeConfigWithDefaults checks each part of the given Config and
@@ -75,18 +125,35 @@ func defaultConfig() *Config {
 func mergeConfigWithDefaults(conf *Config) {
 	d := defaultConfig()
 	conf.Action = checkAction(conf.Action, d.Action)
+	conf.Clipboard = checkClipboard(conf.Clipboard, d.Clipboard)
+	conf.ClipboardClear = checkClipboardClear(conf.ClipboardClear, d.ClipboardClear)
+	conf.EditFormat = checkEditFormat(conf.EditFormat, d.EditFormat)
 	conf.Editor = checkEditor(conf.Editor, d.Editor)
 	conf.FilterMode = checkFilterMode(conf.FilterMode, d.FilterMode)
+	conf.Normalizers = checkNormalizers(conf.Normalizers, d.Normalizers)
+	conf.OnDuplicate = checkOnDuplicate(conf.OnDuplicate, d.OnDuplicate)
+	conf.PipeMode = checkPipeMode(conf.PipeMode, d.PipeMode)
+	conf.PipeSeparator = checkPipeSeparator(conf.PipeSeparator, d.PipeSeparator)
+	conf.PipeTimeout = checkPipeTimeout(conf.PipeTimeout, d.PipeTimeout)
 	conf.PrintLines = checkPrintLines(conf.PrintLines, d.PrintLines)
 	conf.SortOrder = checkSortOrder(conf.SortOrder, d.SortOrder)
 	conf.Store = checkStoreFile(conf.Store, d.Store)
+	conf.ArchiveFile = checkSidePath(conf.ArchiveFile, conf.Store, archiveFilePath(conf.Store))
+	conf.BackupCount = checkBackupCount(conf.BackupCount, d.BackupCount)
+	conf.BackupDays = checkBackupDays(conf.BackupDays, d.BackupDays)
+	conf.BackupDir = checkSidePath(conf.BackupDir, conf.Store, backupDirPath(conf.Store))
+	conf.TagAliases = checkTagAliases(conf.TagAliases, d.TagAliases)
+	conf.TrashDays = checkTrashDays(conf.TrashDays, d.TrashDays)
 }
 
 // checkAction checks if the given action is valid. If so, the string
-// is just returned. If not, the default action is returned.
+// is just returned, with a leading `~/` in its first word, the tool,
+// expanded. The arguments are left as they are. If not, the default
+// action is returned.
 func checkAction(_act string, def string) string {
-	if strings.Contains(_act, "~") {
-		_act = path.Clean(strings.Replace(_act, "~", userHome(), -1))
+	_act = strings.TrimSpace(_act)
+	if strings.HasPrefix(_act, "~/") {
+		_act = userHome() + _act[1:]
 	}
 	if (len(_act) > 0) {
 		return _act
@@ -95,6 +162,36 @@ func checkAction(_act string, def string) string {
 	}
 }
 
+// checkClipboard ensures that the clipboard backend is "auto" or
+// the name of a known backend.
+func checkClipboard(name string, def string) string {
+	if _, ok := findClipboardBackend(name); ok {
+		return name
+	} else {
+		return def
+	}
+}
+
+// checkClipboardClear ensures that the number of seconds to wait
+// before clearing the clipboard isn't negative. Zero means never.
+func checkClipboardClear(secs int, def int) int {
+	if secs >= 0 {
+		return secs
+	} else {
+		return def
+	}
+}
+
+// checkEditFormat ensures that the format of the edit file is one
+// of the known formats.
+func checkEditFormat(format string, def string) string {
+	if (format == "text" || format == "yaml" || format == "json") {
+		return format
+	} else {
+		return def
+	}
+}
+
 // checkEditor is a convenience function for getting the user's text
 // editor. If the environment variable is not set, then the default
 // specified above will be used.
@@ -116,10 +213,66 @@ func checkFilterMode(_mode string, def string) string {
 	}
 }
 
+// checkNormalizers ensures that each of the value normalizers is
+// known. If any isn't, or there are none, the defaults are returned.
+func checkNormalizers(names []string, def []string) []string {
+	if len(names) == 0 {
+		return def
+	}
+
+	for _, name := range names {
+		if name != "whitespace" && name != "case" && name != "url" {
+			return def
+		}
+	}
+
+	return names
+}
+
+// checkOnDuplicate ensures that the policy for creating a record
+// that duplicates an existing one is valid.
+func checkOnDuplicate(policy string, def string) string {
+	if (policy == "ask" || policy == "merge" || policy == "create" || policy == "skip" || policy == "abort") {
+		return policy
+	} else {
+		return def
+	}
+}
+
+// checkPipeMode ensures that the pipe mode is valid: each record
+// piped separately, all joined by the separator, or as JSON.
+func checkPipeMode(mode string, def string) string {
+	if (mode == PipeModeEach || mode == PipeModeJoin || mode == PipeModeJSON) {
+		return mode
+	} else {
+		return def
+	}
+}
+
+// checkPipeSeparator ensures that the pipe separator names a known
+// separator.
+func checkPipeSeparator(sep string, def string) string {
+	if (sep == "newline" || sep == "nul" || sep == "tab") {
+		return sep
+	} else {
+		return def
+	}
+}
+
+// checkPipeTimeout ensures that the number of seconds the pipe_to
+// tool may run isn't negative. Zero means no limit.
+func checkPipeTimeout(secs int, def int) int {
+	if secs >= 0 {
+		return secs
+	} else {
+		return def
+	}
+}
+
 // checkPrintLines ensures that the number of lines to print is
-// 1 or 2.
+// 1, 2, or 3.
 func checkPrintLines(num string, def string) string {
-	if (num == "1" || num == "2") {
+	if (num == "1" || num == "2" || num == "3") {
 		return num
 	} else {
 		return def
@@ -135,8 +288,9 @@ func checkSortOrder(order string, def string) string {
 	}
 }
 
-// checkStoreFile ensures that the user's store file exists. It
-// returns the given file name's absolute path.
+// checkStoreFile ensures that the user's store file exists. A new
+// store file gets the current version's header. It returns the given
+// file name's absolute path.
 func checkStoreFile(_path string, def string) string {
 	var abs_path string
 
@@ -150,13 +304,106 @@ func checkStoreFile(_path string, def string) string {
 	}
 
 	if !doesFileExist(abs_path) {
-		file := createFile(abs_path)
-		file.Close()
+		createStoreFile(abs_path)
 	}
 
 	return abs_path
 }
 
+// checkTagAliases cleans each tag and alias, drops empty ones and
+// aliases of themselves, and ensures the map isn't nil. Since a tag
+// with aliases can't also be an alias, such aliases are dropped too.
+func checkTagAliases(aliases map[string][]string, def map[string][]string) map[string][]string {
+	if aliases == nil {
+		return def
+	}
+
+	clean := make(map[string][]string)
+	for tag, list := range aliases {
+		if tag = cleanTagPath(tag); tag != "" {
+			clean[tag] = mergeTags(clean[tag], list)
+		}
+	}
+
+	for tag, list := range clean {
+		var kept []string
+		for _, alias := range list {
+			if _, in := clean[alias]; !in && alias != tag {
+				kept = append(kept, alias)
+			}
+		}
+		if len(kept) == 0 {
+			delete(clean, tag)
+		} else {
+			clean[tag] = kept
+		}
+	}
+
+	return clean
+}
+
+// archiveFilePath returns the path to the default archive file for
+// the store file named by the given string. It's kept next to the
+// store.
+func archiveFilePath(store string) string {
+	return store + ".archive"
+}
+
+// checkSidePath returns the given path, for a file or directory kept
+// alongside the given store file, made absolute, or the default if
+// it's empty. A relative path is relative to the store's directory,
+// so it's the same wherever star is run. Unlike the store file, it
+// isn't created until it's needed.
+func checkSidePath(_path string, store string, def string) string {
+	switch {
+	case _path == "":
+		return def
+	case strings.Contains(_path, "~"):
+		return path.Clean(strings.Replace(_path, "~", userHome(), -1))
+	case path.IsAbs(_path):
+		return path.Clean(_path)
+	default:
+		return path.Join(path.Dir(store), _path)
+	}
+}
+
+// backupDirPath returns the path to the default backup directory for
+// the store file named by the given string. It's kept next to the
+// store.
+func backupDirPath(store string) string {
+	return path.Join(path.Dir(store), DefaultBackupDirName)
+}
+
+// checkBackupCount ensures that at least one backup of the store is
+// kept.
+func checkBackupCount(count int, def int) int {
+	if count > 0 {
+		return count
+	} else {
+		return def
+	}
+}
+
+// checkBackupDays ensures that the number of days to keep a daily
+// backup for isn't negative. Zero means none are kept.
+func checkBackupDays(days int, def int) int {
+	if days >= 0 {
+		return days
+	} else {
+		return def
+	}
+}
+
+// checkTrashDays ensures that the number of days to keep deleted
+// records in the trash isn't negative. Zero means forever.
+func checkTrashDays(days int, def int) int {
+	if days >= 0 {
+		return days
+	} else {
+		return def
+	}
+}
+
 // userHome is a convenience function for getting the user's home.
 func userHome() string {
 	usr, err := user.Current()
@@ -184,6 +431,65 @@ func checkConfigFile() {
 	}
 }
 
+// saveConfigKey replaces the given top-level key in the user's config
+// file with the given value, marshaled as YAML, and leaves the rest
+// of the file, comments included, as it is. If the value is nil, the
+// key is removed. If the key isn't in the file, it's added at the end.
+func saveConfigKey(key string, value interface{}) {
+	checkConfigFile()
+	file_name := configFilePath()
+
+	cont, err := ioutil.ReadFile(file_name)
+	checkForError(err)
+
+	var block []string
+	if value != nil {
+		out, err := yaml.Marshal(map[string]interface{}{key: value})
+		checkForError(err)
+		block = strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(cont), "\n"), "\n")
+	if len(cont) == 0 {
+		lines = nil
+	}
+
+	// The key's block is its line and the indented lines after it.
+	// Blank lines at the end of the block are kept.
+	var kept []string
+	found := false
+	for o := 0; o < len(lines); o++ {
+		if found || !strings.HasPrefix(lines[o], key + ":") {
+			kept = append(kept, lines[o])
+			continue
+		}
+
+		found = true
+		end := o + 1
+		for n := o + 1; n < len(lines); n++ {
+			if strings.TrimSpace(lines[n]) == "" {
+				continue
+			}
+			if lines[n][0] != ' ' && lines[n][0] != '\t' && lines[n][0] != '-' {
+				break
+			}
+			end = n + 1
+		}
+
+		kept = append(kept, block...)
+		o = end - 1
+	}
+	if !found {
+		kept = append(kept, block...)
+	}
+
+	out := strings.Join(kept, "\n")
+	if len(kept) > 0 {
+		out += "\n"
+	}
+	checkForError(ioutil.WriteFile(file_name, []byte(out), 0644))
+}
+
 // saveConfigToFile writes the given Config to the user's config
 // file in the expected YAML format.
 func saveConfigToFile(conf *Config) {
@@ -196,13 +502,38 @@ func saveConfigToFile(conf *Config) {
 	conf_pairs := [][]string{
 		{"store_file", conf.Store},
 		{"filter_mode", conf.FilterMode},
+		{"archive_file", conf.ArchiveFile},
+		{"backup_dir", conf.BackupDir},
+		{"backup_count", strconv.Itoa(conf.BackupCount)},
+		{"backup_days", strconv.Itoa(conf.BackupDays)},
+		{"include_expired", strconv.FormatBool(conf.IncludeExpired)},
+		{"on_duplicate", conf.OnDuplicate},
+		{"normalizers", "[" + strings.Join(conf.Normalizers, ", ") + "]"},
 		{"pipe_to", conf.Action},
+		{"pipe_mode", conf.PipeMode},
+		{"pipe_separator", conf.PipeSeparator},
+		{"pipe_timeout", strconv.Itoa(conf.PipeTimeout)},
 		{"editor", conf.Editor},
-		{"print_lines", conf.PrintLines}}
+		{"edit_format", conf.EditFormat},
+		{"clipboard", conf.Clipboard},
+		{"clipboard_clear", strconv.Itoa(conf.ClipboardClear)},
+		{"trash_days", strconv.Itoa(conf.TrashDays)},
+		{"print_lines", conf.PrintLines},
+		{"sort_order", conf.SortOrder},
+		{"search_notes", strconv.FormatBool(conf.SearchNotes)},
+		{"canonicalize_tags", strconv.FormatBool(conf.CanonicalizeTags)}}
 
 	for _, pair := range conf_pairs {
 		conf_line := []string{pair[0], ": ", pair[1], "\n"}
 		_, err := file_handle.WriteString(strings.Join(conf_line, ""))
 		checkForError(err)
 	}
+
+	// The aliases are nested, so they're marshaled.
+	if len(conf.TagAliases) > 0 {
+		out, err := yaml.Marshal(map[string]map[string][]string{"tag_aliases": conf.TagAliases})
+		checkForError(err)
+		_, err = file_handle.Write(out)
+		checkForError(err)
+	}
 }
@@ -1,43 +1,327 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
 
 // makeCreateAction returns the Create action function. It requires
-// the user's config and the terms given on the command line.
-func makeCreateAction(conf *Config, terms []string) func() {
+// the user's config, the action code, and the terms given on the
+// command line. Depending on the action code, the value will be the
+// first term, or it will be read from stdin or the user's editor,
+// in which case all the terms are tags.
+func makeCreateAction(conf *Config, act *ActionCode, terms []string) func() {
 	action := func() {
-		if len(terms) == 0 {
-			printTermCreationError()
-		} else {
-			record := makeRecordFromInput(terms)
-			appendRecordsToFile(conf.Store, []Record{record})
+		attrs, err := cleanAttrs(act.Attrs)
+		if err == nil {
+			err = checkNote(act.Note)
 		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't create the entry: %v\n", err)
+			return
+		}
+
+		if len(act.Bulk) > 0 {
+			createRecordsInBulk(conf, act, terms, attrs)
+			return
+		}
+
+		var value string
+
+		switch {
+		case act.ValueFrom == ValueFromStdin:
+			value, err = readValueFromStdin()
+		case act.ValueFrom == ValueFromEditor:
+			value, err = readValueFromEditor(conf)
+		case len(terms) == 0:
+			createRecordsInEditor(conf, act.Force, attrs, act.Note)
+			return
+		default:
+			value, terms = terms[0], terms[1:]
+		}
+
+		if err == nil {
+			err = checkNewValue(value)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't create the entry: %v\n", err)
+			return
+		}
+
+		record := makeRecordFromInput(append([]string{value}, terms...))
+		record.Attrs = attrs
+		record.Note = strings.TrimSpace(act.Note)
+		saveNewRecords(conf, act.Force, []Record{record})
 	}
 
 	return action
 }
 
+// createRecordsInEditor opens a template for a new record in the
+// user's editor, in the configured edit format, and appends the
+// records from it to the store once the editor closes. The given
+// attributes are added to each record, and the given note is the
+// note of each record that doesn't have its own. The file is checked
+// just like when editing records. Duplicates are handled by
+// `saveNewRecords`.
+func createRecordsInEditor(conf *Config, force bool, attrs []string, note string) {
+	tmp_name := getTempFileName("new", editFileExtension(conf.EditFormat))
+	tmp_file := createFile(tmp_name)
+	writeNewRecordTemplate(tmp_file, conf.EditFormat)
+	tmp_file.Close()
+
+	var records []Record
+	review := func(ed_recs map[int]Record) string {
+		records = nil
+
+		keys := make([]int, 0, len(ed_recs))
+		for key := range ed_recs {
+			keys = append(keys, key)
+		}
+		sort.Ints(keys)
+
+		for _, key := range keys {
+			record := ed_recs[key]
+			record.Tags = dedupeTags(record.Tags)
+			record.Attrs = mergeAttrs(attrs, record.Attrs)
+			if len(record.Note) == 0 {
+				record.Note = strings.TrimSpace(note)
+			}
+			if err := checkNewValue(record.Value); err != nil {
+				fmt.Fprintf(os.Stderr, "Can't create the entry: %v\n", err)
+				if shouldReopenEditor() {
+					return "reopen"
+				}
+				return "no"
+			}
+			if record.Meta == nil {
+				record.Meta = makeRecordFromInput([]string{""}).Meta
+			}
+			records = append(records, record)
+		}
+
+		if len(records) == 0 {
+			return "no"
+		}
+		return "yes"
+	}
+
+	if editTempFile(conf, tmp_name, 0, review) {
+		saveNewRecords(conf, force, records)
+	}
+}
+
+// readValueFromStdin reads all of stdin and returns it as a value.
+// A single trailing line break, as most input ends with, is removed.
+func readValueFromStdin() (string, error) {
+	input, err := ioutil.ReadAll(StdinReader)
+	if err != nil {
+		return "", err
+	}
+
+	return trimFinalLineBreak(string(input)), nil
+}
+
+// readValueFromEditor opens an empty temp file in the user's editor
+// and returns its contents as a value once the editor closes. A
+// single trailing line break, as most editors add, is removed.
+func readValueFromEditor(conf *Config) (string, error) {
+	tmp_name := getTempFileName("new", ".tmp")
+	createFile(tmp_name).Close()
+	defer os.Remove(tmp_name)
+
+	ed := checkEditor(conf.Editor, getEnv("EDITOR", DefaultEditorPath))
+	if err := pipeToToolAsArg(tmp_name, ed); err != nil {
+		return "", err
+	}
+
+	input, err := ioutil.ReadFile(tmp_name)
+	if err != nil {
+		return "", err
+	}
+
+	return trimFinalLineBreak(string(input)), nil
+}
+
+// trimFinalLineBreak removes one line break from the end of the
+// given string, if it has one.
+func trimFinalLineBreak(str string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(str, "\n"), "\r")
+}
+
+// checkNewValue returns an error if the given string can't be saved
+// as a value: if it's blank or contains a separator character.
+func checkNewValue(value string) error {
+	switch {
+	case strings.TrimSpace(value) == "":
+		return fmt.Errorf("the value is empty")
+	case hasSeparators(value):
+		return fmt.Errorf("the value contains an ASCII separator character")
+	default:
+		return nil
+	}
+}
+
 // makeRecordFromInput transforms the given terms, adds initial meta-
-// data, and returns a fully-formed Record.
+// data, and returns a fully-formed Record. Repeated tags are removed.
 func makeRecordFromInput(terms []string) Record {
 	val := terms[0]
-	tags := terms[1:]
+	tags := dedupeTags(terms[1:])
 
 	s := strconv.FormatInt(time.Now().Unix(), 10)
 	times := []string{s, "0", "0"}
 
-	return Record{val, tags, times, 0.0}
+	return Record{val, tags, times, nil, "", 0.0}
+}
+
+// createRecordsInBulk reads records from the file named in the
+// action code (or stdin, if that's "-") in the action code's bulk
+// format, adds the given terms to each record's tags and the given
+// attributes to its attributes, and appends them all to the store.
+// The action code's note is the note of each record that doesn't
+// have its own. If any record can't be read, none will be added.
+func createRecordsInBulk(conf *Config, act *ActionCode, terms []string, attrs []string) {
+	var input []byte
+	var err error
+	if act.Bulk == "-" {
+		input, err = ioutil.ReadAll(StdinReader)
+	} else {
+		input, err = ioutil.ReadFile(act.Bulk)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Can't read the records: %v\n", err)
+		return
+	}
+
+	records, errs := parseBulkRecords(string(input), getBulkFormat(act), terms, attrs)
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "No entries created. The records have problems:\n")
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "  %v\n", e)
+		}
+		return
+	}
+
+	if len(records) == 0 {
+		fmt.Printf("No entries to create.\n")
+		return
+	}
+
+	for o := range records {
+		if len(records[o].Note) == 0 {
+			records[o].Note = strings.TrimSpace(act.Note)
+		}
+	}
+
+	saveNewRecords(conf, act.Force, records)
+}
+
+// getBulkFormat returns the format named in the action code. If it
+// isn't named, it's guessed from the file's extension, and if that
+// doesn't help, it's the plain "lines" format.
+func getBulkFormat(act *ActionCode) string {
+	switch {
+	case len(act.BulkFormat) > 0:
+		return act.BulkFormat
+	case strings.HasSuffix(act.Bulk, ".tsv"):
+		return "tsv"
+	case strings.HasSuffix(act.Bulk, ".jsonl"):
+		return "jsonl"
+	default:
+		return "lines"
+	}
+}
+
+// parseBulkRecords transforms the given input into Records. Each
+// line of the input is one record, in one of these formats:
+//   lines: the value, a tab, then a comma-separated list of tags
+//   tsv:   the value, then each tag, all separated by tabs
+//   jsonl: a JSON object like {"value": "...", "tags": ["..."]},
+//          optionally with "attrs": {"key": "value", ...} and
+//          "note": "..."
+// Blank lines are skipped. The given extra tags and attributes are
+// added to each record. Lines that can't be read are returned as
+// errors.
+func parseBulkRecords(input string, format string, extra_tags []string, extra_attrs []string) ([]Record, []EditFileError) {
+	var records []Record
+	var errs []EditFileError
+
+	for o, line := range strings.Split(input, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var value string
+		var tags, attrs []string
+		var note string
+
+		switch {
+		case format == "jsonl":
+			var obj struct {
+				Value string `json:"value"`
+				Tags []string `json:"tags"`
+				Attrs map[string]string `json:"attrs"`
+				Note string `json:"note"`
+			}
+			dec := json.NewDecoder(strings.NewReader(line))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&obj); err != nil {
+				errs = append(errs, EditFileError{o + 1, strings.TrimPrefix(err.Error(), "json: ")})
+				continue
+			}
+			value, tags, attrs, note = obj.Value, obj.Tags, makeAttrsFromMap(obj.Attrs), obj.Note
+		case format == "tsv":
+			cols := strings.Split(line, "\t")
+			value, tags = cols[0], cols[1:]
+		case format == "lines":
+			cols := strings.SplitN(line, "\t", 2)
+			value = cols[0]
+			if len(cols) > 1 {
+				tags = strings.Split(cols[1], ",")
+			}
+		default:
+			return nil, []EditFileError{{0, fmt.Sprintf("unknown format `%v`", format)}}
+		}
+
+		if err := checkNewValue(value); err != nil {
+			errs = append(errs, EditFileError{o + 1, err.Error()})
+			continue
+		}
+		if err := checkNote(note); err != nil {
+			errs = append(errs, EditFileError{o + 1, err.Error()})
+			continue
+		}
+
+		attrs, err := cleanAttrs(append(attrs, extra_attrs...))
+		if err != nil {
+			errs = append(errs, EditFileError{o + 1, err.Error()})
+			continue
+		}
+
+		tags = append(tags, extra_tags...)
+		record := makeRecordFromInput(append([]string{value}, cleanInputTags(strings.Join(tags, ","))...))
+		record.Attrs = attrs
+		record.Note = strings.TrimSpace(note)
+		records = append(records, record)
+	}
+
+	return records, errs
 }
 
 // appendRecordsToFile appends the given records, one by one, to the
-// file named by the given string.
+// file named by the given string. The store is locked for the write.
 func appendRecordsToFile(file_name string, records []Record) {
+	unlock := lockFile(file_name)
+	defer unlock()
+
 	file, err := os.OpenFile(file_name, os.O_APPEND|os.O_WRONLY, 0600)
 	checkForError(err)
 	defer file.Close()
@@ -47,8 +331,13 @@ func appendRecordsToFile(file_name string, records []Record) {
 	}
 }
 
-// printTermCreationError prints usage information on how to create
-// a new entry.
-func printTermCreationError() {
-	fmt.Fprintf(os.Stderr, "A new entry needs a value and any number of tags. Example:\n  $ star -n value tag1 tag2 tag3")
+// addRecordsToStore backs up the user's store file, migrating it if
+// it's in an older version, appends the given new records to it, and
+// records the named operation in the journal.
+func addRecordsToStore(conf *Config, op string, records []Record) {
+	if !migrateStoreFile(conf) {
+		backupStoreFile(conf)
+	}
+	appendRecordsToFile(conf.Store, records)
+	appendJournalEntry(conf.Store, op, 0, nil, records)
 }
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+
+// makeTestConfig returns a default Config with its store, and the
+// files kept next to it, in a new temp directory.
+func makeTestConfig(t *testing.T) *Config {
+	dir := t.TempDir()
+	conf := defaultConfig()
+	conf.Store = path.Join(dir, "store")
+	conf.ArchiveFile = archiveFilePath(conf.Store)
+	conf.BackupDir = backupDirPath(conf.Store)
+	createStoreFile(conf.Store)
+	return conf
+}
+
+// setTestStdin replaces stdin with a pipe that reads the given input.
+// The original stdin is put back when the test ends.
+func setTestStdin(t *testing.T, input string) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.WriteString(input); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	stdin, reader := os.Stdin, StdinReader
+	os.Stdin, StdinReader = r, bufio.NewReader(r)
+	t.Cleanup(func() {
+		os.Stdin, StdinReader = stdin, reader
+		r.Close()
+	})
+}
+
+// captureStdout calls the given function and returns what it printed
+// to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = stdout
+	w.Close()
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// readTestStore returns the Records in the given Config's store.
+func readTestStore(conf *Config) []Record {
+	var records []Record
+	forEachRecordInFile(conf.Store, func(record Record) {
+		records = append(records, record)
+	})
+	return records
+}
+
+func TestCreateFromStdinSkipsDuplicate(t *testing.T) {
+	conf := makeTestConfig(t)
+	conf.OnDuplicate = "ask"
+	appendRecordsToFile(conf.Store, []Record{makeRecordFromInput([]string{"dup", "old"})})
+
+	setTestStdin(t, "dup\n")
+	act := defaultActionCode()
+	act.ValueFrom = ValueFromStdin
+	out := captureStdout(t, makeCreateAction(conf, act, []string{"new"}))
+
+	if strings.Contains(out, "(M)erge") || strings.Contains(out, "No entries created") {
+		t.Errorf("got a prompt or an abort from stdin that's been read: %q", out)
+	}
+
+	found := readTestStore(conf)
+	if len(found) != 1 {
+		t.Fatalf("got %v entries, want 1", len(found))
+	}
+	if found[0].Value != "dup" || len(found[0].Tags) != 1 || found[0].Tags[0] != "old" {
+		t.Errorf("got %v %v, want the existing entry unchanged", found[0].Value, found[0].Tags)
+	}
+}
+
+func TestBulkFromStdinSkipsDuplicates(t *testing.T) {
+	conf := makeTestConfig(t)
+	conf.OnDuplicate = "ask"
+	appendRecordsToFile(conf.Store, []Record{makeRecordFromInput([]string{"dup", "old"})})
+
+	setTestStdin(t, "dup\nfresh\n")
+	act := defaultActionCode()
+	act.Bulk = "-"
+	captureStdout(t, makeCreateAction(conf, act, []string{"new"}))
+
+	found := readTestStore(conf)
+	if len(found) != 2 || found[1].Value != "fresh" {
+		t.Fatalf("got %v, want the existing entry and the new one", found)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+
+// RecordGroup is a structure that pairs a group of Records that
+// duplicate each other with the Record they'll be merged into.
+type RecordGroup struct {
+	Records []Record
+	Merged Record
+}
+
+
+// makeDeduper returns the Dedupe main action function. It groups the
+// Records in the store by normalized value and, for each group with
+// more than one Record, asks the user which value to keep, then
+// merges the groups in one pass over the store. If `confirm` is
+// false, every group will be merged, keeping the first value.
+func makeDeduper(conf *Config, confirm bool) func() {
+	deduper := func() {
+		groups := findDuplicateGroups(conf)
+		if len(groups) == 0 {
+			fmt.Printf("No duplicates found.\n")
+			return
+		}
+
+		var wanted []RecordGroup
+	out:
+		for o, group := range groups {
+			fmt.Printf("Group %v of %v:\n", (o + 1), len(groups))
+			listRecordsToStdout(group)
+
+			keep := 1
+			if confirm {
+				input := promptForInput(fmt.Sprintf("Keep which value? (1-%v), (s)kip, or (q)uit: ", len(group)))
+				switch {
+				case input == "" || input == "1":
+					keep = 1
+				case strings.ToLower(input) == "q":
+					break out
+				default:
+					n, err := strconv.Atoi(input)
+					if err != nil || n < 1 || n > len(group) {
+						fmt.Printf("Skipping.\n")
+						continue
+					}
+					keep = n
+				}
+			}
+
+			wanted = append(wanted, RecordGroup{group, mergeRecords(group, keep - 1)})
+		}
+
+		if len(wanted) == 0 {
+			fmt.Printf("Nothing merged.\n")
+			return
+		}
+
+		saveMergesToStore(conf, wanted)
+		fmt.Printf("Merged %v.\n", pluralize(len(wanted), "group", "groups"))
+	}
+
+	return deduper
+}
+
+// findDuplicateGroups reads the store and returns the groups of
+// Records that have the same value once normalized. Each group is
+// sorted with the most accessed Record first.
+func findDuplicateGroups(conf *Config) [][]Record {
+	var keys []string
+	by_key := make(map[string][]Record)
+
+	forEachRecordInFile(conf.Store, func(record Record) {
+		key := normalizeValue(record.Value, conf.Normalizers)
+		if _, in := by_key[key]; !in {
+			keys = append(keys, key)
+		}
+		by_key[key] = append(by_key[key], record)
+	})
+
+	var groups [][]Record
+	for _, key := range keys {
+		if group := by_key[key]; len(group) > 1 {
+			sort.SliceStable(group, func(i, j int) bool {
+				_, _, count_i := parseRecordMeta(group[i].Meta)
+				_, _, count_j := parseRecordMeta(group[j].Meta)
+				return count_i > count_j
+			})
+			groups = append(groups, group)
+		}
+	}
+
+	return groups
+}
+
+// mergeRecords returns a Record with the value of the Record at the
+// given index, the union of all the tags, the earliest created time,
+// the latest accessed time, and the sum of the access counts.
+func mergeRecords(group []Record, keep int) Record {
+	merged := Record{}
+	merged.Value = group[keep].Value
+
+	var created, accessed int64
+	var count int
+	for o, record := range group {
+		merged.Tags = mergeTags(merged.Tags, record.Tags)
+
+		c, a, n := parseRecordMeta(record.Meta)
+		if o == 0 || (c > 0 && (c < created || created == 0)) {
+			created = c
+		}
+		if a > accessed {
+			accessed = a
+		}
+		count += n
+	}
+	merged.Meta = formatRecordMeta(created, accessed, count)
+	for _, record := range group {
+		if isRecordPinned(record) {
+			merged = setRecordPinned(merged, true)
+			break
+		}
+	}
+
+	// The kept Record's attributes win over the others'.
+	for _, record := range group {
+		merged.Attrs = mergeAttrs(merged.Attrs, record.Attrs)
+	}
+	merged.Attrs = mergeAttrs(merged.Attrs, group[keep].Attrs)
+
+	// So does its note, if it has one.
+	merged.Note = group[keep].Note
+	for _, record := range group {
+		if len(merged.Note) == 0 {
+			merged.Note = record.Note
+		}
+	}
+
+	return merged
+}
+
+// saveMergesToStore replaces the Records in each of the given groups
+// with the group's merged Record, in one pass over the store. The
+// merged Record takes the place of the group's first Record in the
+// store, and the rest are dropped. The merges are recorded in the
+// journal.
+func saveMergesToStore(conf *Config, groups []RecordGroup) {
+	written := make([]bool, len(groups))
+	var before, after []Record
+
+	merger := func(bk_file *os.File, record Record) {
+		for n, group := range groups {
+			for m, chk := range group.Records {
+				if ((chk.Value == record.Value) && (reflect.DeepEqual(chk.Tags, record.Tags))) {
+					groups[n].Records = removeRecord(group.Records, m)
+					before = append(before, record)
+					if !written[n] {
+						saveRecordToFile(bk_file, group.Merged)
+						after = append(after, group.Merged)
+						written[n] = true
+					}
+					return
+				}
+			}
+		}
+
+		saveRecordToFile(bk_file, record)
+	}
+
+	updateStore(conf, merger)
+	appendJournalEntry(conf.Store, "dedupe", 0, before, after)
+}
+
+// normalizeValue returns the given value in the form used to check
+// for duplicates, by applying each of the named normalizers:
+//   whitespace: trim both ends and make each run of whitespace one space
+//   case: make it lowercase
+//   url: canonicalize URLs, as in `canonicalizeURL`
+func normalizeValue(value string, normalizers []string) string {
+	for _, name := range normalizers {
+		switch {
+		case name == "whitespace":
+			value = strings.Join(strings.Fields(value), " ")
+		case name == "case":
+			value = strings.ToLower(value)
+		case name == "url":
+			value = canonicalizeURL(value)
+		}
+	}
+
+	return value
+}
+
+// canonicalizeURL returns the given string in a canonical form if
+// it's an HTTP or HTTPS URL: the scheme is dropped (so both match),
+// the host is lowercased, default ports and empty fragments are
+// dropped, and the path loses its trailing slash. Other strings are
+// returned as they are.
+func canonicalizeURL(value string) string {
+	trimmed := strings.TrimSpace(value)
+	u, err := url.Parse(trimmed)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return value
+	}
+
+	host := strings.ToLower(u.Host)
+	host = strings.TrimSuffix(strings.TrimSuffix(host, ":80"), ":443")
+
+	canon := "//" + host + strings.TrimRight(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		canon += "?" + u.RawQuery
+	}
+	if u.Fragment != "" {
+		canon += "#" + u.Fragment
+	}
+
+	return canon
+}
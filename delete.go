@@ -2,7 +2,6 @@ package main
 
 import (
 	"os"
-	"reflect"
 )
 
 
@@ -18,25 +17,41 @@ func makeDeleter(conf *Config) func([]Record) {
 }
 
 // saveDeletionsToStore ensures that records marked for deletion
-// are removed from the user's store file.
+// are removed from the user's store file and moved to the trash. The
+// trash is written first, so if that fails, nothing is lost from the
+// store. The deletion is recorded in the journal.
 func saveDeletionsToStore(conf *Config, records []Record) {
-	deleter := func(bk_file *os.File, record Record) {
-		should_bk := true
-
-		for n, chk := range records {
-			if ((chk.Value == record.Value) && (reflect.DeepEqual(chk.Tags, record.Tags))) {
-				records = removeRecord(records, n)
-				should_bk = false
-				break
-			}
-		}
+	deleted := findStoredRecords(conf.Store, records)
+	moveRecordsToTrash(conf, deleted)
 
-		if should_bk {
+	pending := append([]Record{}, deleted...)
+	deleter := func(bk_file *os.File, record Record) {
+		if n := findRecordIndex(pending, record); n >= 0 {
+			pending = removeRecord(pending, n)
+		} else {
 			saveRecordToFile(bk_file, record)
 		}
 	}
 
-	updateStoreFile(conf.Store, deleter)
+	updateStore(conf, deleter)
+	appendJournalEntry(conf.Store, "delete", 0, deleted, nil)
+}
+
+// findStoredRecords returns the Records in the store file named by
+// the given string with the same value and tags as the given Records,
+// as they are in the store. Each given Record is matched once.
+func findStoredRecords(store string, records []Record) []Record {
+	pending := append([]Record{}, records...)
+	var found []Record
+
+	forEachRecordInFile(store, func(record Record) {
+		if n := findRecordIndex(pending, record); n >= 0 {
+			pending = removeRecord(pending, n)
+			found = append(found, record)
+		}
+	})
+
+	return found
 }
 
 // removeRecord returns a copy of the given slice of Records but
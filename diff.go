@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+
+// These are the ANSI escape codes used to color output.
+const (
+	ColorRed = "\x1b[31m"
+	ColorGreen = "\x1b[32m"
+	ColorYellow = "\x1b[33m"
+	ColorReset = "\x1b[0m"
+)
+
+
+// colorize wraps the given string in the given color code, unless
+// stdout isn't a terminal or the NO_COLOR environment variable is
+// set, in which case the string is returned as it is.
+func colorize(str string, color string) string {
+	if os.Getenv("NO_COLOR") != "" {
+		return str
+	}
+
+	if info, err := os.Stdout.Stat(); err != nil || (info.Mode() & os.ModeCharDevice) == 0 {
+		return str
+	}
+
+	return color + str + ColorReset
+}
+
+// printEditDiff prints the changes that the given adds, edits, and
+// deletions will make to the store. For each edited record, the
+// changed value, the added and removed tags and attributes, the
+// changed note, and changed metadata are shown.
+func printEditDiff(adds []Record, edits [][]Record, dels []Record) {
+	for _, pair := range edits {
+		old_rec, new_rec := pair[0], pair[1]
+		fmt.Printf("%v %v\n", colorize("~", ColorYellow), indentValue(old_rec.Value, "  "))
+
+		if old_rec.Value != new_rec.Value {
+			fmt.Printf("    %v\n", colorize("- " + indentValue(old_rec.Value, "      "), ColorRed))
+			fmt.Printf("    %v\n", colorize("+ " + indentValue(new_rec.Value, "      "), ColorGreen))
+		}
+
+		added, removed := diffTags(old_rec.Tags, new_rec.Tags)
+		if len(added) > 0 {
+			fmt.Printf("    %v\n", colorize("+ tags: " + strings.Join(added, ", "), ColorGreen))
+		}
+		if len(removed) > 0 {
+			fmt.Printf("    %v\n", colorize("- tags: " + strings.Join(removed, ", "), ColorRed))
+		}
+
+		added, removed = diffTags(old_rec.Attrs, new_rec.Attrs)
+		if len(added) > 0 {
+			fmt.Printf("    %v\n", colorize("+ attrs: " + strings.Join(added, ", "), ColorGreen))
+		}
+		if len(removed) > 0 {
+			fmt.Printf("    %v\n", colorize("- attrs: " + strings.Join(removed, ", "), ColorRed))
+		}
+
+		if old_rec.Note != new_rec.Note {
+			fmt.Printf("    %v\n", colorize("- note: " + indentValue(old_rec.Note, "            "), ColorRed))
+			fmt.Printf("    %v\n", colorize("+ note: " + indentValue(new_rec.Note, "            "), ColorGreen))
+		}
+
+		if !reflect.DeepEqual(old_rec.Meta, new_rec.Meta) {
+			fmt.Printf("    %v\n", colorize("~ meta: " + strings.Join(old_rec.Meta, ", ") + " -> " + strings.Join(new_rec.Meta, ", "), ColorYellow))
+		}
+	}
+
+	for _, record := range adds {
+		fmt.Printf("%v\n", colorize("+ " + indentValue(record.Value, "  "), ColorGreen))
+		fmt.Printf("    %v\n", colorize("  tags: " + strings.Join(record.Tags, ", "), ColorGreen))
+		if len(record.Attrs) > 0 {
+			fmt.Printf("    %v\n", colorize("  attrs: " + strings.Join(record.Attrs, ", "), ColorGreen))
+		}
+		if len(record.Note) > 0 {
+			fmt.Printf("    %v\n", colorize("  note: " + indentValue(record.Note, "          "), ColorGreen))
+		}
+	}
+
+	for _, record := range dels {
+		fmt.Printf("%v\n", colorize("- " + indentValue(record.Value, "  "), ColorRed))
+		fmt.Printf("    %v\n", colorize("  tags: " + strings.Join(record.Tags, ", "), ColorRed))
+	}
+}
+
+// indentValue indents each line of the given value after the first
+// with the given string, so multi-line values line up.
+func indentValue(value string, indent string) string {
+	return strings.Replace(value, "\n", "\n" + indent, -1)
+}
+
+// diffTags returns the tags in `new_tags` that aren't in `old_tags`
+// and the tags in `old_tags` that aren't in `new_tags`.
+func diffTags(old_tags []string, new_tags []string) ([]string, []string) {
+	old_ref := make(map[string]bool)
+	for _, tag := range old_tags {
+		old_ref[tag] = true
+	}
+
+	new_ref := make(map[string]bool)
+	for _, tag := range new_tags {
+		new_ref[tag] = true
+	}
+
+	var added, removed []string
+	for _, tag := range new_tags {
+		if tag != "" && !old_ref[tag] {
+			added = append(added, tag)
+		}
+	}
+	for _, tag := range old_tags {
+		if tag != "" && !new_ref[tag] {
+			removed = append(removed, tag)
+		}
+	}
+
+	return added, removed
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+
+// saveNewRecords appends the given new Records to the store, after
+// checking each for an existing Record with the same value. Unless
+// `force` is true, what happens to duplicates depends on the config's
+// `on_duplicate` policy: ask, merge their tags into the existing
+// Record, create them anyway, skip them, or abort.
+func saveNewRecords(conf *Config, force bool, records []Record) {
+	canonicalizeRecordTags(conf, records)
+	adds, merges, ok := resolveDuplicates(conf, force, records)
+	if !ok {
+		fmt.Printf("No entries created.\n")
+		return
+	}
+
+	if len(merges) > 0 {
+		saveEditsToStore(conf, "create", adds, merges, nil)
+		fmt.Printf("Merged tags into %v.\n", pluralize(len(merges), "entry", "entries"))
+	} else if len(adds) > 0 {
+		addRecordsToStore(conf, "create", adds)
+	}
+
+	if len(adds) > 0 {
+		fmt.Printf("Created %v.\n", pluralize(len(adds), "entry", "entries"))
+	}
+}
+
+// resolveDuplicates checks each of the given new Records for a Record
+// with the same value, once normalized as in `normalizeValue`, either
+// in the store or earlier in the given slice. It returns the Records
+// to add, pairs of existing and merged Records (as used by
+// `saveEditsToStore`), and a bool that will be false if the user
+// chose to abort.
+func resolveDuplicates(conf *Config, force bool, records []Record) ([]Record, [][]Record, bool) {
+	if force {
+		return records, nil, true
+	}
+
+	existing := make(map[string]Record)
+	forEachRecordInFile(conf.Store, func(record Record) {
+		key := normalizeValue(record.Value, conf.Normalizers)
+		if _, in := existing[key]; !in {
+			existing[key] = record
+		}
+	})
+
+	var adds []Record
+	var merges [][]Record
+	added := make(map[string]int)
+	merged := make(map[string]int)
+
+	for _, record := range records {
+		key := normalizeValue(record.Value, conf.Normalizers)
+
+		if n, in := added[key]; in {
+			adds[n].Tags = mergeTags(adds[n].Tags, record.Tags)
+			adds[n].Attrs = mergeAttrs(adds[n].Attrs, record.Attrs)
+			continue
+		}
+
+		old_rec, in := existing[key]
+		if !in {
+			added[key] = len(adds)
+			adds = append(adds, record)
+			continue
+		}
+
+		switch getDuplicatePolicy(conf, old_rec, record) {
+		case "merge":
+			if n, in := merged[key]; in {
+				merges[n][1].Tags = mergeTags(merges[n][1].Tags, record.Tags)
+				merges[n][1].Attrs = mergeAttrs(merges[n][1].Attrs, record.Attrs)
+			} else {
+				new_rec := old_rec
+				new_rec.Tags = mergeTags(old_rec.Tags, record.Tags)
+				new_rec.Attrs = mergeAttrs(old_rec.Attrs, record.Attrs)
+				if len(new_rec.Note) == 0 {
+					new_rec.Note = record.Note
+				}
+				merged[key] = len(merges)
+				merges = append(merges, []Record{old_rec, new_rec})
+			}
+		case "create":
+			added[key] = len(adds)
+			adds = append(adds, record)
+		case "skip":
+			fmt.Fprintf(os.Stderr, "Skipped \"%v\", which already exists.\n", record.Value)
+		default:
+			return nil, nil, false
+		}
+	}
+
+	return adds, merges, true
+}
+
+// getDuplicatePolicy returns the config's `on_duplicate` policy for
+// the given new Record, which duplicates the given existing Record.
+// If the policy is to ask, the user will be shown both and asked,
+// unless stdin isn't a terminal, in which case the new Record is
+// skipped.
+func getDuplicatePolicy(conf *Config, old_rec Record, new_rec Record) string {
+	if conf.OnDuplicate != "ask" {
+		return conf.OnDuplicate
+	}
+	if !isStdinTerminal() {
+		return "skip"
+	}
+
+	fmt.Printf("An entry with this value already exists:\n")
+	listRecordsToStdout([]Record{old_rec})
+	fmt.Printf("New tags: %v\n", strings.Join(new_rec.Tags, ", "))
+
+	if len(new_rec.Attrs) > 0 {
+		fmt.Printf("New attributes: %v\n", strings.Join(new_rec.Attrs, ", "))
+	}
+
+	answer := promptForChoice("(M)erge the tags into it, (c)reate anyway, or (a)bort? ", []string{"merge", "create", "abort"}, "merge")
+	if answer == "" {
+		return "abort"
+	}
+	return answer
+}
+
+// mergeTags returns the tags in `a` followed by the tags in `b` that
+// aren't in `a`, without empty tags.
+func mergeTags(a []string, b []string) []string {
+	return dedupeTags(append(append([]string{}, a...), b...))
+}
+
+// dedupeTags returns the given tags with whitespace and stray path
+// separators trimmed and with empty and repeated tags removed. The
+// order is kept.
+func dedupeTags(tags []string) []string {
+	var clean []string
+	ref := make(map[string]bool)
+
+	for _, tag := range tags {
+		trimmed := cleanTagPath(tag)
+
+		if trimmed != "" && !ref[trimmed] {
+			clean = append(clean, trimmed)
+			ref[trimmed] = true
+		}
+	}
+
+	return clean
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"gopkg.in/yaml.v2"
+)
+
+
+// EditDocument is the structure of the temp file used for editing
+// records in the YAML and JSON edit formats.
+type EditDocument struct {
+	Records []EditRecord `yaml:"records" json:"records"`
+}
+
+// EditRecord is the structured form of a Record in an EditDocument.
+// The ID corresponds to the number the record was listed with. New
+// records have no ID. If Meta is left out, the record's metadata
+// won't change.
+type EditRecord struct {
+	ID int `yaml:"id,omitempty" json:"id,omitempty"`
+	Value string `yaml:"value" json:"value"`
+	Tags []string `yaml:"tags" json:"tags"`
+	Attrs map[string]string `yaml:"attrs,omitempty" json:"attrs,omitempty"`
+	Note string `yaml:"note" json:"note"`
+	Meta *EditMeta `yaml:"meta,omitempty" json:"meta,omitempty"`
+}
+
+// EditFileError describes a problem found in an edit file. If the
+// Line is 0, the problem isn't tied to a line.
+type EditFileError struct {
+	Line int
+	Message string
+}
+
+// EditMeta is the structured form of a Record's metadata: the Unix
+// times it was created and last accessed, its access count, and
+// whether it's pinned.
+type EditMeta struct {
+	Created int64 `yaml:"created" json:"created"`
+	Accessed int64 `yaml:"accessed" json:"accessed"`
+	Count int `yaml:"count" json:"count"`
+	Pinned bool `yaml:"pinned,omitempty" json:"pinned,omitempty"`
+}
+
+
+// EditFileErrorMarker starts each line that describes problems in
+// an edit file. Those lines are removed before the file is read, so
+// the problems from the last read don't pile up.
+const EditFileErrorMarker = "#!"
+
+// The value of EditFileYAMLInstructions will be written to the top
+// of the temporary file used for editing entries in the YAML format.
+// JSON has no comments, so that format has no instructions, but
+// lines that start with a pound sign will still be ignored.
+const EditFileYAMLInstructions = `# STAR will read this file and update its store with the new values.
+#
+# Each record has an id, a value, a list of tags, optional key/value
+# attributes, a note, and metadata:
+#
+#   - id: 1
+#     value: http://settlement.arc.nasa.gov/70sArtHiRes/70sArt/art.html
+#     tags: [art, NASA, space]
+#     attrs: {source: nasa, year: "1975"}
+#     note: Art from the NASA Ames summer studies
+#     meta: {created: 1545955200, accessed: 0, count: 0, pinned: true}
+#
+# Multi-line values and notes can be written as YAML block scalars
+# (value: |).
+#
+# You can remove records from the store file by deleting them, and
+# you can add records by creating more without an id or meta.
+#
+# Lines that start with a pound sign will be ignored. If STAR can't
+# read this file, it will note the problems at the top and let you
+# fix them, or give up without changing the store.
+
+`
+
+
+// Error returns the EditFileError's message, with its line number.
+func (e EditFileError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %v: %v", e.Line, e.Message)
+	}
+	return e.Message
+}
+
+// editFileExtension returns the file name extension for the given
+// edit format, so the user's editor can recognize the file.
+func editFileExtension(format string) string {
+	switch {
+	case format == "yaml":
+		return ".yaml"
+	case format == "json":
+		return ".json"
+	default:
+		return ".tmp"
+	}
+}
+
+// writeRecordsToEditFile writes the given records to the given file
+// in the given edit format.
+func writeRecordsToEditFile(file *os.File, records []Record, format string) {
+	switch {
+	case format == "yaml":
+		file.WriteString(EditFileYAMLInstructions)
+		out, err := yaml.Marshal(makeEditDocument(records))
+		checkForError(err)
+		file.Write(out)
+	case format == "json":
+		out, err := json.MarshalIndent(makeEditDocument(records), "", "  ")
+		checkForError(err)
+		file.Write(append(out, '\n'))
+	default:
+		file.WriteString(EditFileInstructions)
+		listRecordsToTempFile(records, file)
+	}
+}
+
+// writeNewRecordTemplate writes a template for a new record to the
+// given file in the given edit format.
+func writeNewRecordTemplate(file *os.File, format string) {
+	doc := EditDocument{[]EditRecord{{Value: "", Tags: []string{}}}}
+
+	switch {
+	case format == "yaml":
+		file.WriteString(EditFileYAMLInstructions)
+		out, err := yaml.Marshal(doc)
+		checkForError(err)
+		file.Write(out)
+	case format == "json":
+		out, err := json.MarshalIndent(doc, "", "  ")
+		checkForError(err)
+		file.Write(append(out, '\n'))
+	default:
+		file.WriteString(EditFileInstructions)
+		file.WriteString("1) \n   Tags: \n   Note: \n")
+	}
+}
+
+// parseRecordsFromEditFile reads the file named by the given string
+// in the given edit format. It returns the same map of Records as
+// `parseRecordsFromTempFile`. The number of records that were
+// written to the file is needed to check the IDs. If the file isn't
+// valid, the problems will be returned as EditFileErrors.
+func parseRecordsFromEditFile(tmp_name string, format string, count int) (map[int]Record, []EditFileError) {
+	if format != "yaml" && format != "json" {
+		return parseRecordsFromTempFile(tmp_name)
+	}
+
+	cont, err := ioutil.ReadFile(tmp_name)
+	checkForError(err)
+
+	var doc EditDocument
+	if format == "yaml" {
+		if err = yaml.UnmarshalStrict(cont, &doc); err != nil {
+			return nil, makeYAMLEditFileErrors(err)
+		}
+	} else {
+		// Comment lines are blanked rather than removed so the line
+		// numbers in errors stay right.
+		cont = regexp.MustCompile("(?m)^[ \\t]*#.*$").ReplaceAll(cont, []byte{})
+		dec := json.NewDecoder(bytes.NewReader(cont))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&doc)
+		if err == nil && dec.More() {
+			err = fmt.Errorf("unexpected data after the document")
+		}
+		if err != nil {
+			return nil, []EditFileError{makeJSONEditFileError(err, cont)}
+		}
+	}
+
+	records, err := validateEditDocument(doc, count)
+	if err != nil {
+		return nil, []EditFileError{{0, err.Error()}}
+	}
+
+	return records, nil
+}
+
+// makeYAMLEditFileErrors transforms the given error from the YAML
+// parser into EditFileErrors. The parser includes line numbers in
+// its messages, so those are pulled out.
+func makeYAMLEditFileErrors(err error) []EditFileError {
+	var msgs []string
+	if type_err, ok := err.(*yaml.TypeError); ok {
+		msgs = type_err.Errors
+	} else {
+		msgs = []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+
+	re_line := regexp.MustCompile("^line ([0-9]+): (.*)$")
+
+	var errs []EditFileError
+	for _, msg := range msgs {
+		if n := re_line.FindStringSubmatch(msg); n != nil {
+			line, _ := strconv.Atoi(n[1])
+			errs = append(errs, EditFileError{line, n[2]})
+		} else {
+			errs = append(errs, EditFileError{0, msg})
+		}
+	}
+
+	return errs
+}
+
+// makeJSONEditFileError transforms the given error from the JSON
+// decoder into an EditFileError. If the error includes an offset
+// into the given content, that's used to find the line number.
+func makeJSONEditFileError(err error, cont []byte) EditFileError {
+	offset := int64(-1)
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	}
+
+	msg := strings.TrimPrefix(err.Error(), "json: ")
+	if offset < 0 || offset > int64(len(cont)) {
+		return EditFileError{0, msg}
+	}
+
+	return EditFileError{bytes.Count(cont[:offset], []byte("\n")) + 1, msg}
+}
+
+// removeEditFileErrors removes the error lines added to the file
+// named by the given string by `insertEditFileErrors`.
+func removeEditFileErrors(tmp_name string) {
+	cont, err := ioutil.ReadFile(tmp_name)
+	checkForError(err)
+
+	var kept []string
+	for _, line := range strings.SplitAfter(string(cont), "\n") {
+		if !strings.HasPrefix(line, EditFileErrorMarker) {
+			kept = append(kept, line)
+		}
+	}
+
+	err = ioutil.WriteFile(tmp_name, []byte(strings.Join(kept, "")), 0644)
+	checkForError(err)
+}
+
+// insertEditFileErrors writes the given errors as comments at the top
+// of the file named by the given string. The line numbers in those
+// comments are shifted to account for the comments.
+func insertEditFileErrors(tmp_name string, errs []EditFileError) {
+	cont, err := ioutil.ReadFile(tmp_name)
+	checkForError(err)
+
+	lines := []string{
+		EditFileErrorMarker + " STAR couldn't read this file. Fix these problems, save it, and close it.",
+	}
+	shift := len(errs) + 2
+	for _, e := range errs {
+		if e.Line > 0 {
+			e.Line += shift
+		}
+		lines = append(lines, EditFileErrorMarker + "   " + e.Error())
+	}
+	lines = append(lines, EditFileErrorMarker, "")
+
+	err = ioutil.WriteFile(tmp_name, append([]byte(strings.Join(lines, "\n")), cont...), 0644)
+	checkForError(err)
+}
+
+// printEditFileErrors prints the given errors to stderr.
+func printEditFileErrors(errs []EditFileError) {
+	fmt.Fprintf(os.Stderr, "The edit file has problems:\n")
+	for _, e := range errs {
+		fmt.Fprintf(os.Stderr, "  %v\n", e.Error())
+	}
+}
+
+// shouldReopenEditor asks the user whether to reopen the editor to
+// fix the edit file or to abort. It returns true for reopen.
+func shouldReopenEditor() bool {
+	return promptForChoice("(R)eopen the editor or (a)bort? ", []string{"reopen", "abort"}, "reopen") == "reopen"
+}
+
+// makeEditDocument transforms the given records into an EditDocument.
+func makeEditDocument(records []Record) EditDocument {
+	doc := EditDocument{make([]EditRecord, len(records))}
+
+	for o, record := range records {
+		doc.Records[o] = EditRecord{o + 1, record.Value, record.Tags, makeAttrMap(record.Attrs), record.Note, makeEditMeta(record.Meta)}
+	}
+
+	return doc
+}
+
+// makeEditMeta transforms the given Record metadata into an EditMeta.
+// If the metadata isn't well-formed, nil will be returned, which
+// will leave it out of the edit file.
+func makeEditMeta(meta []string) *EditMeta {
+	if len(meta) != 3 && (len(meta) != 4 || meta[3] != MetaPinned) {
+		return nil
+	}
+
+	created, err1 := strconv.ParseInt(meta[0], 10, 64)
+	accessed, err2 := strconv.ParseInt(meta[1], 10, 64)
+	count, err3 := strconv.Atoi(meta[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil
+	}
+
+	return &EditMeta{created, accessed, count, len(meta) == 4}
+}
+
+// validateEditDocument checks each record in the given EditDocument
+// and transforms it into a Record. Records with an ID are keyed by
+// their index in the slice of wanted Records, and new records are
+// keyed past the end of it. The first problem found will be
+// returned as an error.
+func validateEditDocument(doc EditDocument, count int) (map[int]Record, error) {
+	records := make(map[int]Record)
+	next := count
+
+	for o, ed_rec := range doc.Records {
+		if strings.TrimSpace(ed_rec.Value) == "" {
+			return nil, fmt.Errorf("record %v has no value", o + 1)
+		}
+
+		record := Record{}
+		record.Value = ed_rec.Value
+		record.Tags = cleanInputTags(strings.Join(ed_rec.Tags, ","))
+
+		attrs, err := cleanAttrs(makeAttrsFromMap(ed_rec.Attrs))
+		if err != nil {
+			return nil, fmt.Errorf("record %v: %v", o + 1, err)
+		}
+		record.Attrs = attrs
+
+		record.Note = strings.TrimSpace(ed_rec.Note)
+
+		if err := checkRecordText(record); err != nil {
+			return nil, fmt.Errorf("record %v: %v", o + 1, err)
+		}
+
+		if ed_rec.Meta != nil {
+			meta := ed_rec.Meta
+			if meta.Created < 0 || meta.Accessed < 0 || meta.Count < 0 {
+				return nil, fmt.Errorf("record %v has negative metadata", o + 1)
+			}
+			record.Meta = []string{
+				strconv.FormatInt(meta.Created, 10),
+				strconv.FormatInt(meta.Accessed, 10),
+				strconv.Itoa(meta.Count)}
+			if meta.Pinned {
+				record.Meta = append(record.Meta, MetaPinned)
+			}
+		}
+
+		switch {
+		case ed_rec.ID == 0:
+			records[next] = record
+			next += 1
+		case ed_rec.ID < 0 || ed_rec.ID > count:
+			return nil, fmt.Errorf("record %v has an unknown id (%v)", o + 1, ed_rec.ID)
+		default:
+			if _, in := records[ed_rec.ID - 1]; in {
+				return nil, fmt.Errorf("record %v has a duplicate id (%v)", o + 1, ed_rec.ID)
+			}
+			records[ed_rec.ID - 1] = record
+		}
+	}
+
+	return records, nil
+}
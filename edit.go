@@ -2,7 +2,9 @@ package main
 
 import (
 	"bufio"
-	// "fmt"
+	"bytes"
+	"fmt"
+	"io/ioutil"
 	"os"
 	"reflect"
 	"regexp"
@@ -21,66 +23,178 @@ const EditFileInstructions = `# STAR will read this file and update its store wi
 #
 #   1) http://settlement.arc.nasa.gov/70sArtHiRes/70sArt/art.html
 #      Tags: art, NASA, space
+#      Attrs: source=nasa, year=1975
 #
 # Those parts are:
 # - At the start of a line (spaces excluded) a number followed by a closing parenthesis
 # - The entry, being the string that gets copied, opened, etc
 # - At the start of a line (spaces excluded) the word "Tags" followed by a colon
 # - The tags, being a comma-separated list
+# - Optionally, the word "Attrs" followed by a colon and a comma-
+#   separated list of key=value attributes
+# - Optionally, the word "Note" followed by a colon and a note
+#
+# An entry or a note can span multiple lines. Each line after the
+# first starts (spaces excluded) with a vertical bar and a space:
+#
+#   2) SELECT *
+#      | FROM records
+#      Tags: sql
+#      Note: Everything,
+#      | for debugging
 #
 # You can remove entries from the store file by deleting the line
 # pairs, and you can add entries by creating more.
 #
-# Lines that start with a pound sign will be ignored.
+# Lines that start with a pound sign will be ignored. If STAR can't
+# read this file, it will note the problems at the top and let you
+# fix them, or give up without changing the store.
 
 `
 
 
+// EditFileContinuation starts each line after the first of a multi-
+// line value in the edit file.
+const EditFileContinuation = "| "
+
+
 // makeEditor returns the Edit search action function: the returned
 // function will receive the slice of wanted Records and run the edit
 // routine of printing the records to a temp file, reading & parsing
 // that temp file, and incorporating the changes into the updated
-// store file. Through this process records can be updated and added
-// but not deleted.
-func makeEditor(conf *Config) func([]Record) {
+// store file. Through this process records can be updated, added,
+// and deleted. If `confirm` is true, the changes will be shown and
+// the user asked to confirm them before they're saved.
+func makeEditor(conf *Config, confirm bool) func([]Record) {
 	ed := func(records []Record) {
 		// Create the temp file, add the instructions and records.
-		tmp_name := getTempFileName("edit")
+		tmp_name := getTempFileName("edit", editFileExtension(conf.EditFormat))
 		tmp_file := createFile(tmp_name)
-		tmp_file.WriteString(EditFileInstructions)
-		listRecordsToTempFile(records, tmp_file)
+		writeRecordsToEditFile(tmp_file, records, conf.EditFormat)
 		tmp_file.Close()
 
-		// Open temp file in the user's editor, wait for editor to close.
-		ed := checkEditor(conf.Editor, getEnv("EDITOR", DefaultEditorPath))
-		pipeToToolAsArg(tmp_name, ed)
+		var edits [][]Record
+		var adds, dels []Record
+		review := func(ed_recs map[int]Record) string {
+			edits, adds, dels = collateRecordsByIndex(records, ed_recs)
+			canonicalizeRecordTags(conf, adds)
+			for _, pair := range edits {
+				canonicalizeRecordTags(conf, pair[1:])
+			}
+			// fmt.Printf("Parsed records from temp file `%v`:\nEDITS: %v\nNEWS: %v\nDELETIONS: %v\n", tmp_name, edits, adds, dels)
 
-		// Read and parse temp file.
-		ed_recs := parseRecordsFromTempFile(tmp_name)
-		edits, adds, dels := collateRecordsByIndex(records, ed_recs)
-		// fmt.Printf("Parsed records from temp file `%v`:\nEDITS: %v\nNEWS: %v\nDELETIONS: %v\n", tmp_name, edits, adds, dels)
+			if !confirm || (len(edits) + len(adds) + len(dels)) == 0 {
+				return "yes"
+			}
 
-		// Delete the temp file.
-		err := os.Remove(tmp_name)
-		checkForError(err)
+			printEditDiff(adds, edits, dels)
+			return promptToSaveEdits()
+		}
+
+		if !editTempFile(conf, tmp_name, len(records), review) {
+			return
+		}
 
 		// Update the store file with all those changes.
-		saveEditsToStore(conf, adds, edits, dels)
+		if (len(edits) + len(adds) + len(dels)) == 0 {
+			fmt.Printf("No changes.\n")
+		} else {
+			saveEditsToStore(conf, "edit", adds, edits, dels)
+		}
 	}
 
 	return ed
 }
 
-// saveEditsToStore receives the user's config and three slices that
-// contain records to add, edit, and delete, and does those things
-// to the store file indicated in the config.
-func saveEditsToStore(conf *Config, adds []Record, edits [][]Record, dels []Record) {
+// editTempFile opens the temp file named by the given string in the
+// user's editor, waits for the editor to close, then reads and parses
+// the file in the configured edit format. The number of records that
+// were written to the file is needed to check the IDs. The parsed
+// records are passed to the `review` function, which returns "yes"
+// to save them, "no" to discard them, or "reopen" to reopen the
+// editor. If the editor fails, the edits won't be trusted. If the
+// file can't be read, the user can fix it or give up. If the file
+// wasn't changed, there's nothing to do. It returns true if the
+// records should be saved. The temp file is removed, unless it holds
+// edits that weren't saved but might be wanted.
+func editTempFile(conf *Config, tmp_name string, count int, review func(map[int]Record) string) bool {
+	ed := checkEditor(conf.Editor, getEnv("EDITOR", DefaultEditorPath))
+
+	original, err := ioutil.ReadFile(tmp_name)
+	checkForError(err)
+
+	for {
+		if err := pipeToToolAsArg(tmp_name, ed); err != nil {
+			fmt.Fprintf(os.Stderr, "No changes saved. Your edits are in %v\n", tmp_name)
+			return false
+		}
+
+		removeEditFileErrors(tmp_name)
+		if edited, err := ioutil.ReadFile(tmp_name); err == nil && bytes.Equal(edited, original) {
+			fmt.Printf("No changes.\n")
+			checkForError(os.Remove(tmp_name))
+			return false
+		}
+
+		ed_recs, errs := parseRecordsFromEditFile(tmp_name, conf.EditFormat, count)
+		if len(errs) > 0 {
+			printEditFileErrors(errs)
+			insertEditFileErrors(tmp_name, errs)
+			if shouldReopenEditor() {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "No changes saved. Your edits are in %v\n", tmp_name)
+			return false
+		}
+
+		if answer := review(ed_recs); answer == "yes" {
+			break
+		} else if answer == "no" {
+			fmt.Printf("No changes saved.\n")
+			checkForError(os.Remove(tmp_name))
+			return false
+		}
+	}
+
+	// Delete the temp file.
+	err = os.Remove(tmp_name)
+	checkForError(err)
+
+	return true
+}
+
+// promptToSaveEdits asks the user whether to save the changes shown,
+// discard them, or reopen the editor. It returns "yes", "no", or
+// "reopen".
+func promptToSaveEdits() string {
+	answer := promptForChoice("Save these changes? (y)es, (n)o, or (r)eopen the editor: ", []string{"yes", "no", "reopen"}, "")
+	if answer == "" {
+		return "no"
+	}
+	return answer
+}
+
+// saveEditsToStore receives the user's config, the name of the
+// operation, and three slices that contain records to add, edit, and
+// delete, and does those things to the store file indicated in the
+// config. Deleted records are moved to the trash before the store is
+// changed, so if that fails, nothing is lost. The changes are recorded
+// in the journal.
+func saveEditsToStore(conf *Config, op string, adds []Record, edits [][]Record, dels []Record) {
+	var before, after []Record
+
+	deleted := findStoredRecords(conf.Store, dels)
+	moveRecordsToTrash(conf, deleted)
+	dels = append([]Record{}, deleted...)
+
 	editer := func(bk_file *os.File, record Record) {
 		should_bk := true
 
 		for n, mod := range edits {
 			if ((mod[0].Value == record.Value) && (reflect.DeepEqual(mod[0].Tags, record.Tags))) {
 				saveRecordToFile(bk_file, mod[1])
+				before = append(before, record)
+				after = append(after, mod[1])
 				edits = removeRecordPair(edits, n)
 				should_bk = false
 				break
@@ -100,10 +214,12 @@ func saveEditsToStore(conf *Config, adds []Record, edits [][]Record, dels []Reco
 		}
 	}
 
-	updateStoreFile(conf.Store, editer)
+	updateStore(conf, editer)
 	if len(adds) > 0 {
 		appendRecordsToFile(conf.Store, adds)
 	}
+
+	appendJournalEntry(conf.Store, op, len(after), append(before, deleted...), append(after, adds...))
 }
 
 // parseRecordsFromTempFile reads the file named by the given string
@@ -112,8 +228,9 @@ func saveEditsToStore(conf *Config, adds []Record, edits [][]Record, dels []Reco
 // record will be preceded by a number, as they are when printed in
 // the terminal. That number corresponds to an index in the slice of
 // wanted Records, and that's how the updates are paired with the
-// existing Records.
-func parseRecordsFromTempFile(tmp_name string) map[int]Record {
+// existing Records. Lines that can't be read are returned as errors
+// rather than skipped, since a skipped record would be deleted.
+func parseRecordsFromTempFile(tmp_name string) (map[int]Record, []EditFileError) {
 	tmp_file, err := os.Open(tmp_name)
 	checkForError(err)
 	defer tmp_file.Close()
@@ -121,40 +238,111 @@ func parseRecordsFromTempFile(tmp_name string) map[int]Record {
 	reader := bufio.NewReader(tmp_file)
 
 	records := make(map[int]Record)
+	var errs []EditFileError
 
 	var index int
-	var value string
-	var tags []string
+	var value, note string
+	var tags, attrs []string
+	var val_line int
 	pairing := false
+	has_tags := false
+	has_attrs := false
+	has_note := false
+
+	re_val := regexp.MustCompile("^[ ]*([0-9]+)\\)(?: (.*))?$")
+	re_tag := regexp.MustCompile("^[ ]*(?:Tags:[ ]*)(.*)$")
+	re_attr := regexp.MustCompile("^[ ]*(?:Attrs:[ ]*)(.*)$")
+	re_note := regexp.MustCompile("^[ ]*(?:Note:[ ]*)(.*)$")
+	re_cont := regexp.MustCompile("^[ \t]*\\|(.*)$")
+
+	// finishPair adds the record being read to the map.
+	finishPair := func() {
+		if !pairing {
+			return
+		}
 
-	re_val := regexp.MustCompile("^[ ]*([0-9]+)\\)[ ]+(.+)$")
-	re_tag := regexp.MustCompile("^[ ]*(?:Tags:[ ]*)(.+)$")
+		record := Record{}
+		record.Value = value
+		record.Tags = tags
+		record.Attrs = attrs
+		record.Note = strings.TrimSpace(note)
+
+		if !has_tags {
+			errs = append(errs, EditFileError{val_line, "this record has no Tags line"})
+		} else if _, in := records[index]; in {
+			errs = append(errs, EditFileError{val_line, fmt.Sprintf("the number %v is used more than once", index + 1)})
+		} else if err := checkRecordText(record); err != nil {
+			errs = append(errs, EditFileError{val_line, err.Error()})
+		} else {
+			records[index] = record
+		}
 
-	for {
-		line, last := readNextEntry(reader, '\n')
+		pairing = false
+	}
 
-		if pairing && (line == "" || last) {
-			record := Record{}
-			record.Value = value
-			record.Tags = tags
-			records[index] = record
-			pairing = false
-		} else if n := re_val.FindStringSubmatch(line); n != nil {
-			if pairing {
-				record := Record{}
-				record.Value = value
-				record.Tags = tags
-				records[index] = record
-				pairing = false
-			}
+	for line_num := 1; ; line_num++ {
+		// Values and continued lines are matched before trimming so
+		// that their whitespace is kept.
+		raw, err := reader.ReadString('\n')
+		last := (err != nil)
+		raw = strings.TrimRight(raw, "\r\n")
+		line := strings.TrimSpace(raw)
+
+		if line == "" {
+			finishPair()
+		} else if line[0] == '#' {
+			// Comments are ignored.
+		} else if n := re_val.FindStringSubmatch(raw); n != nil {
+			finishPair()
 
 			chk, err := strconv.Atoi(n[1])
-			checkForError(err)
-			index = chk - 1
-			value = strings.TrimSpace(n[2])
-			pairing = true
+			if err != nil || chk < 1 {
+				errs = append(errs, EditFileError{line_num, fmt.Sprintf("`%v` isn't a valid record number", n[1])})
+			} else {
+				index = chk - 1
+				value = n[2]
+				tags = nil
+				attrs = nil
+				note = ""
+				val_line = line_num
+				pairing = true
+				has_tags = false
+				has_attrs = false
+				has_note = false
+			}
+		} else if n := re_cont.FindStringSubmatch(raw); n != nil {
+			if pairing && has_note {
+				note += "\n" + strings.TrimPrefix(n[1], " ")
+			} else if !pairing || has_tags {
+				errs = append(errs, EditFileError{line_num, "this continued line doesn't follow a numbered value or a Note line"})
+			} else {
+				value += "\n" + strings.TrimPrefix(n[1], " ")
+			}
 		} else if n := re_tag.FindStringSubmatch(line); n != nil {
-			tags = cleanInputTags(strings.TrimSpace(n[1]))
+			if !pairing || has_tags {
+				errs = append(errs, EditFileError{line_num, "this Tags line doesn't follow a numbered value"})
+			} else {
+				tags = cleanInputTags(strings.TrimSpace(n[1]))
+				has_tags = true
+			}
+		} else if n := re_attr.FindStringSubmatch(line); n != nil {
+			if !pairing || !has_tags || has_attrs || has_note {
+				errs = append(errs, EditFileError{line_num, "this Attrs line doesn't follow a Tags line"})
+			} else if parsed, err := parseAttrList(n[1]); err != nil {
+				errs = append(errs, EditFileError{line_num, err.Error()})
+			} else {
+				attrs = parsed
+				has_attrs = true
+			}
+		} else if n := re_note.FindStringSubmatch(line); n != nil {
+			if !pairing || !has_tags || has_note {
+				errs = append(errs, EditFileError{line_num, "this Note line doesn't follow a Tags or Attrs line"})
+			} else {
+				note = n[1]
+				has_note = true
+			}
+		} else {
+			errs = append(errs, EditFileError{line_num, "this line isn't a numbered value, a Tags, Attrs, or Note line, or a comment"})
 		}
 
 		if last {
@@ -162,21 +350,27 @@ func parseRecordsFromTempFile(tmp_name string) map[int]Record {
 		}
 	}
 
-	return records
+	finishPair()
+
+	return records, errs
 }
 
 // collateRecordsByIndex pairs the Records parsed from the edit file
 // with the slice of wanted Records. If Records are present that do
 // not correspond to the slice of wanted Records, then those are new
-// Records, and they'll be added to the updated store file.
+// Records, and they'll be added to the updated store file. Parsed
+// Records without metadata keep the metadata of the Record they
+// replace; new Records get fresh metadata.
 func collateRecordsByIndex(ref_recs []Record, new_recs map[int]Record) ([][]Record, []Record, []Record) {
 	var deletions []Record
 	var collated [][]Record
 	for index, old_rec := range ref_recs {
 		new_rec, in := new_recs[index]
 		if in {
-			if ((new_rec.Value != old_rec.Value) || (!reflect.DeepEqual(new_rec.Tags, old_rec.Tags))) {
+			if new_rec.Meta == nil {
 				new_rec.Meta = old_rec.Meta
+			}
+			if ((new_rec.Value != old_rec.Value) || (!reflect.DeepEqual(new_rec.Tags, old_rec.Tags)) || (!reflect.DeepEqual(new_rec.Meta, old_rec.Meta)) || (!reflect.DeepEqual(new_rec.Attrs, old_rec.Attrs)) || (new_rec.Note != old_rec.Note)) {
 				collated = append(collated, []Record{old_rec, new_rec})
 			}
 			delete(new_recs, index)
@@ -188,7 +382,9 @@ func collateRecordsByIndex(ref_recs []Record, new_recs map[int]Record) ([][]Reco
 	var additions []Record
 	if len(new_recs) > 0 {
 		for _, record := range new_recs {
-			record.Meta = []string{strconv.FormatInt(time.Now().Unix(), 10), "0", "0"}
+			if record.Meta == nil {
+				record.Meta = []string{strconv.FormatInt(time.Now().Unix(), 10), "0", "0"}
+			}
 			additions = append(additions, record)
 		}
 	}
@@ -205,7 +401,7 @@ func cleanInputTags(input string) []string {
 	parts := strings.Split(input, ",")
 
 	for _, part := range parts {
-		trimmed := strings.TrimSpace(part)
+		trimmed := cleanTagPath(part)
 
 		if _, in_ref := ref[trimmed]; in_ref == false {
 			clean = append(clean, trimmed)
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+// ExpiresAttr is the attribute that holds a record's expiry date, as
+// in `expires=2025-12-01`. From that date on, the record is expired:
+// it's hidden from searches, and `--gc` will archive it.
+const ExpiresAttr = "expires"
+
+// ExpiresDateFormat is the format of expiry dates. Expiry times can
+// also be given in RFC 3339 format.
+const ExpiresDateFormat = "2006-01-02"
+
+// MetaExpired is the state that `is:expired` matches.
+const MetaExpired = "expired"
+
+
+// makeCollector returns the GC main action function, which moves the
+// expired records out of the store and into the archive file. The
+// number of expired records is shown first and, unless the action
+// code says not to confirm, the user is asked before the store is
+// changed. The move is recorded in the journal.
+func makeCollector(conf *Config, act *ActionCode) func() {
+	collector := func() {
+		now := time.Now()
+
+		var expired []Record
+		forEachRecordInFile(conf.Store, func(record Record) {
+			if isRecordExpired(record, now) {
+				expired = append(expired, record)
+			}
+		})
+
+		if len(expired) == 0 {
+			fmt.Printf("No entries have expired.\n")
+			return
+		}
+
+		if conf.ArchiveFile == "" {
+			fmt.Fprintf(os.Stderr, "There's no archive file to move the expired entries to. Set one with \"archive_file\" in the config.\n")
+			return
+		}
+
+		fmt.Printf("Will archive %v to %v.\n", pluralize(len(expired), "expired entry", "expired entries"), conf.ArchiveFile)
+		if !act.NoConfirm && promptForChoice("Continue? (y/N) ", []string{"yes", "no"}, "no") != "yes" {
+			fmt.Printf("No changes saved.\n")
+			return
+		}
+
+		// The archive is written first, so if that fails, nothing is
+		// lost from the store.
+		if !doesFileExist(conf.ArchiveFile) {
+			createFile(conf.ArchiveFile).Close()
+		}
+		appendRecordsToFile(conf.ArchiveFile, expired)
+
+		updateStore(conf, func(bk_file *os.File, record Record) {
+			if !isRecordExpired(record, now) {
+				saveRecordToFile(bk_file, record)
+			}
+		})
+
+		appendJournalEntry(conf.Store, "gc", 0, expired, nil)
+		fmt.Printf("Archived %v.\n", pluralize(len(expired), "entry", "entries"))
+	}
+
+	return collector
+}
+
+// parseExpiryDate reads the given expiry, which can be a date like
+// `2025-12-01` or an RFC 3339 time, as saved in a record.
+func parseExpiryDate(expiry string) (time.Time, error) {
+	expiry = strings.TrimSpace(expiry)
+
+	if date, err := time.ParseInLocation(ExpiresDateFormat, expiry, time.Local); err == nil {
+		return date, nil
+	}
+
+	return time.Parse(time.RFC3339, expiry)
+}
+
+// parseExpiry reads the given expiry, which can be a date like
+// `2025-12-01`, an RFC 3339 time, or a span of time from the given
+// time, like `12h`, `7d`, or `2w`. It returns the time of expiry.
+func parseExpiry(expiry string, now time.Time) (time.Time, error) {
+	expiry = strings.TrimSpace(expiry)
+
+	if date, err := parseExpiryDate(expiry); err == nil {
+		return date, nil
+	}
+
+	if n := regexp.MustCompile("^([0-9]+)([hdw])$").FindStringSubmatch(expiry); n != nil {
+		count, _ := strconv.Atoi(n[1])
+		switch {
+		case n[2] == "h":
+			return now.Add(time.Duration(count) * time.Hour), nil
+		case n[2] == "d":
+			return now.AddDate(0, 0, count), nil
+		default:
+			return now.AddDate(0, 0, count * 7), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("`%v` isn't a date like 2025-12-01, a time, or a span like 7d", expiry)
+}
+
+// formatExpiry returns the given time of expiry as it's saved: as a
+// date if it's at the start of a local day, or else in RFC 3339
+// format.
+func formatExpiry(expiry time.Time) string {
+	if expiry.Location() == time.Local && expiry.Hour() == 0 && expiry.Minute() == 0 && expiry.Second() == 0 {
+		return expiry.Format(ExpiresDateFormat)
+	}
+	return expiry.Format(time.RFC3339)
+}
+
+// cleanExpiry returns the given expiry, as read by `parseExpiry`, as
+// it's saved. Spans of days and weeks expire at the start of the day.
+func cleanExpiry(expiry string) (string, error) {
+	date, err := parseExpiry(expiry, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := parseExpiryDate(expiry); err != nil && !strings.HasSuffix(strings.TrimSpace(expiry), "h") {
+		date = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.Local)
+	}
+
+	return formatExpiry(date), nil
+}
+
+// isRecordExpired checks if the given Record's expiry is at or before
+// the given time. A Record with no expiry, or one that can't be read,
+// never expires.
+func isRecordExpired(record Record, now time.Time) bool {
+	expiry, in := makeAttrMap(record.Attrs)[ExpiresAttr]
+	if !in {
+		return false
+	}
+
+	date, err := parseExpiryDate(expiry)
+	if err != nil {
+		return false
+	}
+
+	return !date.After(now)
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bufio"
-	// "fmt"
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"os"
 	"os/user"
 	"strconv"
@@ -15,6 +17,10 @@ import (
 // Functions for reading and acting on records in the store file.
 //
 
+// LockTimeout is how long to wait for another process to release
+// its lock on a file.
+const LockTimeout = 5 * time.Second
+
 // readRecordsFromFile reads the file named by the given string,
 // parses each well-formed entry into a Record, and passes the Record
 // to a function that determines whether it "matches". Each matching
@@ -38,23 +44,30 @@ func readRecordsFromFile(file_name string, getMatchInfo func(Record) (float64, b
 
 // forEachRecordInFile reads the file named by the given string and,
 // for each well-formed entry, it transforms the entry to a Record
-// and passes the Record to the given function.
+// and passes the Record to the given function. Entries are read as
+// the version named in the file's header, if it has one.
 func forEachRecordInFile(file_name string, actOnRecord func(Record)) {
 	file_handle, err := os.Open(file_name)
 	checkForError(err)
 	defer file_handle.Close()
 
 	reader := bufio.NewReader(file_handle)
+	readEntry, err := getStoreFormatReader(1)
+	checkForError(err)
+	first := true
 
 	for {
-		entry, last := readNextEntry(reader, GroupSeparator)
-		parts := splitEntry(entry)
+		entry, last := readNextStoreEntry(reader)
 
-		if (doesEntryHaveParts(parts)) {
-			actOnRecord(makeRecordFromParts(parts))
+		if version, ok := parseStoreHeader(entry); first && ok {
+			readEntry, err = getStoreFormatReader(version)
+			checkForError(err)
+		} else if record, ok := readEntry(splitEntry(entry)); ok {
+			actOnRecord(record)
 		} else {
 			// fmt.Printf("Record is missing components: %v\n", entry)
 		}
+		first = false
 
 		if last {
 			break;
@@ -63,16 +76,24 @@ func forEachRecordInFile(file_name string, actOnRecord func(Record)) {
 }
 
 // updateStoreFile will "update" the file named by the given string
-// by first making a backup and then renaming the backup over the
-// original. The backup process is determined by the `bkMaker` param,
-// which will receive each record in the store and determine how to
-// update it, if at all.
+// by first writing an updated copy and then renaming the copy over
+// the original. The file is locked while that happens. The copy is
+// determined by the `bkMaker` param, which will receive each record
+// in the store and determine how to update it, if at all. To keep a
+// real backup of the store, use `updateStore`. The updated file is
+// written in the current version, with its header.
 func updateStoreFile(file_name string, bkMaker func(*os.File, Record)) {
+	unlock := lockFile(file_name)
+	defer unlock()
+
 	bk_name := file_name + "_bk_" + strconv.FormatInt(time.Now().Unix(), 10)
 	bk_file, err := os.Create(bk_name)
 	checkForError(err)
 	defer bk_file.Close()
 
+	_, err = bk_file.WriteString(makeStoreHeader(StoreFormatVersion))
+	checkForError(err)
+
 	updater := func(record Record) {
 		bkMaker(bk_file, record)
 	}
@@ -96,16 +117,155 @@ func updateStoreFile(file_name string, bkMaker func(*os.File, Record)) {
 // Utility functions.
 //
 
-// readNextEntry reads the given IO buffer up to the next separator.
-// It returns the string read, removing whitespace and the separator.
-func readNextEntry(reader *bufio.Reader, separator byte) (string, bool) {
-	record, err := reader.ReadBytes(separator)
-	last := false
-	if err != nil {
-		last = true
-		// fmt.Printf("Error! %v (%v)\n", err, string(record))
+// lockFile locks the file named by the given string so that other
+// STAR processes won't write to it at the same time. The lock is a
+// file next to it, which works on every OS. If the lock can't be had
+// within LockTimeout, it panics. The returned function releases the
+// lock.
+func lockFile(file_name string) func() {
+	lock_name := file_name + ".lock"
+	deadline := time.Now().Add(LockTimeout)
+
+	for {
+		lock, err := os.OpenFile(lock_name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			lock.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			lock.Close()
+			return func() {
+				os.Remove(lock_name)
+			}
+		}
+
+		if !os.IsExist(err) {
+			checkForError(err)
+		}
+		if time.Now().After(deadline) {
+			checkForError(fmt.Errorf("%v is locked by another process. If it isn't, delete %v", file_name, lock_name))
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// readJSONLines calls the given function with each line in the file
+// named by the given string, in which each line is one JSON value,
+// as the trash and journal are. If the file doesn't exist, there are
+// no lines.
+func readJSONLines(file_name string, actOnLine func([]byte)) {
+	file, err := os.Open(file_name)
+	if os.IsNotExist(err) {
+		return
+	}
+	checkForError(err)
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64 * 1024), 64 * 1024 * 1024)
+	for scanner.Scan() {
+		actOnLine(scanner.Bytes())
+	}
+	checkForError(scanner.Err())
+}
+
+// writeJSONLines replaces the file named by the given string with the
+// given values, each marshaled as JSON on its own line. Like the
+// store, the file is locked while it's written, and the new file is
+// renamed over the old.
+func writeJSONLines(file_name string, values []interface{}) {
+	unlock := lockFile(file_name)
+	defer unlock()
+
+	lines := make([]string, len(values))
+	for o, value := range values {
+		line, err := json.Marshal(value)
+		checkForError(err)
+		lines[o] = string(line) + "\n"
+	}
+
+	bk_name := file_name + "_bk_" + strconv.FormatInt(time.Now().Unix(), 10)
+	bk_file, err := os.OpenFile(bk_name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	checkForError(err)
+	_, err = bk_file.WriteString(strings.Join(lines, ""))
+	checkForError(err)
+	checkForError(bk_file.Close())
+
+	checkForError(os.Rename(bk_name, file_name))
+}
+
+// appendJSONLine adds the given line of JSON to the end of the file
+// named by the given string, which is locked while it's written.
+func appendJSONLine(file_name string, line []byte) {
+	unlock := lockFile(file_name)
+	defer unlock()
+
+	file, err := os.OpenFile(file_name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	checkForError(err)
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	checkForError(err)
+}
+
+// readLastLine returns the last line in the file named by the given
+// string, without its newline. The file is read from the end, a block
+// at a time, so the rest of it isn't read.
+func readLastLine(file_name string) []byte {
+	file, err := os.Open(file_name)
+	checkForError(err)
+	defer file.Close()
+
+	info, err := file.Stat()
+	checkForError(err)
+
+	end := info.Size()
+	var line []byte
+	block := make([]byte, 4096)
+	for end > 0 {
+		start := end - int64(len(block))
+		if start < 0 {
+			start = 0
+		}
+		n, err := file.ReadAt(block[:end - start], start)
+		checkForError(err)
+		line = append(append([]byte{}, block[:n]...), line...)
+		end = start
+
+		trimmed := bytes.TrimRight(line, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return trimmed[i + 1:]
+		}
+	}
+
+	return bytes.TrimRight(line, "\n")
+}
+
+// readNextStoreEntry reads the given IO buffer up to the next group
+// separator, and then the line break that's written after it. Only
+// that line break is removed, so whitespace at the start and end of
+// a value, line breaks included, is kept.
+func readNextStoreEntry(reader *bufio.Reader) (string, bool) {
+	entry, err := reader.ReadBytes(GroupSeparator)
+	if err == nil {
+		skipLineBreak(reader)
+	}
+	return string(entry), (err != nil)
+}
+
+// skipLineBreak reads past one line break, "\n" or "\r\n", if that's
+// what's next in the given IO buffer. It returns the number of bytes
+// it read.
+func skipLineBreak(reader *bufio.Reader) int {
+	next, _ := reader.Peek(2)
+	switch {
+	case len(next) == 2 && next[0] == '\r' && next[1] == '\n':
+		reader.Discard(2)
+		return 2
+	case len(next) > 0 && next[0] == '\n':
+		reader.Discard(1)
+		return 1
+	default:
+		return 0
 	}
-	return strings.TrimSpace(string(record)), last;
 }
 
 // saveRecordToFile writed the given Record to the given file.
@@ -115,11 +275,11 @@ func saveRecordToFile(file *os.File, record Record) {
 }
 
 // getTempFileName returns a temp file whose name includes the given
-// string.
-func getTempFileName(fx string) string {
+// string and ends with the given extension.
+func getTempFileName(fx string, ext string) string {
 	usr, err := user.Current()
 	checkForError(err)
-	return os.TempDir() + "/" + usr.Name + "_star_" + fx + "_" + strconv.FormatInt(time.Now().Unix(), 10) + ".tmp"
+	return os.TempDir() + "/" + usr.Name + "_star_" + fx + "_" + strconv.FormatInt(time.Now().Unix(), 10) + ext
 }
 
 // createFile creates a file named by the given string.
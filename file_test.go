@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+
+func TestStoreRoundTripKeepsLineBreaks(t *testing.T) {
+	conf := makeTestConfig(t)
+	values := []string{
+		"\nstarts with a line break",
+		"ends with a line break\n",
+		"\n\nboth\n\n",
+		"\r\nwindows\r\n",
+		"plain",
+	}
+
+	var records []Record
+	for _, value := range values {
+		records = append(records, makeRecordFromInput([]string{value, "tag"}))
+	}
+	appendRecordsToFile(conf.Store, records)
+
+	// The store is rewritten too, as it is when it's changed.
+	updateStoreFile(conf.Store, func(bk_file *os.File, record Record) {
+		saveRecordToFile(bk_file, record)
+	})
+
+	found := readTestStore(conf)
+	if len(found) != len(values) {
+		t.Fatalf("got %v entries, want %v", len(found), len(values))
+	}
+	for o, value := range values {
+		if found[o].Value != value {
+			t.Errorf("entry %v: got %q, want %q", o, found[o].Value, value)
+		}
+	}
+
+	if problems, _, _ := checkStoreEntries(readStoreEntries(conf.Store)); len(problems) > 0 {
+		t.Errorf("got problems from --check: %v", problems)
+	}
+}
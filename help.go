@@ -18,13 +18,197 @@ func printUsageInformation() {
 
 
   CREATING
-    $ star -n value[ tag...]
+    $ star -n [--attr key=value...] [--note text] [--expires when] value[ tag...]
+    $ star -n
+    $ star -n --stdin[ tag...]
+    $ star -n --editor[ tag...]
+    $ star --bulk (file|-) [--bulk-format (lines|tsv|jsonl)][ tag...]
 
     This command will create a new entry in the store file. An entry
     consists of a value, any number of tags, and metadata (timestamps
     for the dates the value was created and last accessed and a count
     of the number of times the entry has been accessed).
 
+    An entry can also have attributes, which are key=value pairs like
+    "lang=go" or "source=hn". Each --attr adds one to the new entry,
+    or to each entry created with --bulk or in your editor. They can
+    be changed with --edit, and searched with terms like
+    "attr:lang=go" (entries whose "lang" is "go") or "attr:lang"
+    (entries with any "lang").
+
+    An entry can also have a note, for context that doesn't fit in
+    the value or tags. The --note option sets the new entry's note,
+    or the note of each entry created with --bulk or in your editor
+    that doesn't have its own. The template opened in your editor has
+    a place for one too. Notes are searched with terms like
+    "note:deploy", and by every term if "search_notes" is true.
+    They're shown with -3.
+
+    An entry can expire, for things that are only needed for a while.
+    The --expires option sets the "expires" attribute to a date like
+    "2025-12-01", or to a span from now like "12h", "7d", or "2w".
+    From then on, the entry is hidden from searches, unless you give
+    --include-expired or search for "is:expired".
+
+    With no value or tags, a template for the new entry will be opened
+    in your editor, in the "edit_format", and the entry will be
+    created from it once you save it and close the editor.
+
+    With --stdin, the value will be read from stdin, and with
+    --editor, from a file opened in your editor. Either way, all of
+    the terms are tags, and the value can span multiple lines, which
+    is handy for shell snippets, SQL queries, and the like.
+
+    With --bulk, many entries will be read from the given file, or
+    from stdin if that's "-", and added to the store at once. Each
+    line is an entry, in one of these formats:
+      lines: value<tab>tag, tag, tag
+      tsv:   value<tab>tag<tab>tag<tab>tag
+      jsonl: {"value": "value", "tags": ["tag", "tag", "tag"],
+              "attrs": {"key": "value"}}
+    If no --bulk-format is given, it's guessed from the file's
+    extension (.tsv or .jsonl), else it's "lines". Any tags given on
+    the command line are added to every entry. If any line can't be
+    read, no entries are added.
+
+    If an entry with the same value (ignoring extra whitespace)
+    already exists, what happens depends on the "on_duplicate" config:
+    you can be asked, the new tags can be merged into the existing
+    entry, the new entry can be created anyway or skipped, or nothing
+    will be created. If you'd be asked but stdin isn't a terminal, as
+    with --stdin or --bulk -, the new entry is skipped. The --force
+    flag always creates the new entry.
+
+
+  ARCHIVING
+    $ star --gc [--no-confirm]
+
+    This command will move the expired entries out of the store and
+    into the "archive_file". The number of entries is shown first, and
+    you'll be asked to continue, unless you give --no-confirm.
+
+
+  TRASH
+    $ star --trash[ term...]
+    $ star --restore[ term...]
+    $ star --empty-trash [--no-confirm][ date|age]
+
+    Deleted entries, whether with --delete or by removing them in the
+    edit file, are moved to a trash file next to the store, with the
+    time they were deleted. The --trash command shows the entries in
+    the trash that match the terms, newest first, and --restore lets
+    you pick some to put back in the store, just as they were.
+
+    The --empty-trash command permanently removes the entries in the
+    trash, or only those deleted before a date like "2025-12-01" or
+    more than an age like "30d" or "2w" ago. If "trash_days" is more
+    than zero, entries are also removed after that many days.
+
+
+  UNDOING
+    $ star --history[ count]
+    $ star --undo
+    $ star --redo
+
+    Every change to the store, whether creating, editing, deleting,
+    tagging, or pinning an entry, is recorded in a journal next to the
+    store file. Copying and piping only update an entry's metadata, so
+    they aren't recorded. When the journal gets big, its oldest changes
+    are dropped. The --history command lists the most recent changes,
+    10 unless you give another count.
+
+    The --undo command reverts the last change that hasn't been
+    undone, and --redo repeats the first change that has, until you
+    make another change. Entries that were moved to the trash or the
+    archive are moved back too. If the entries have changed since,
+    nothing is undone.
+
+
+  BACKUPS
+    $ star --backups
+    $ star --restore-backup [--no-confirm] number
+
+    Before the store is changed, other than by copying or piping, a
+    copy of it is saved in the "backup_dir". The last "backup_count"
+    copies are kept, along with the last copy from each of the last
+    "backup_days" days. All but the newest are gzipped. The --backups
+    command lists them, newest first, and --restore-backup replaces
+    the store with the numbered one, after backing up the store as it
+    is.
+
+
+  CHECKING
+    $ star --check
+    $ star --repair [--no-confirm]
+
+    The --check command reads every entry in the store and lists the
+    problems it finds, each with the byte offset of its entry: entries
+    with too few parts or stray record separators, invalid metadata
+    or attributes, empty values, stray separators in values or notes,
+    and entries with the same value and tags as another.
+
+    The --repair command fixes what it can, after you confirm, unless
+    you give --no-confirm. Metadata and attributes that can't be read
+    are reset or dropped, stray separators are removed, and duplicate
+    entries are merged. Entries that can't be fixed are moved to a
+    quarantine file next to the store. The store is backed up first.
+
+
+  UPGRADING
+    $ star --init[ store_file]
+
+    The store file starts with a header that gives the version of its
+    format. Store files from older versions of star can still be read,
+    and they're upgraded to the current format, after a backup, the
+    first time they're changed, or when you run --init.
+
+
+  DEDUPING
+    $ star --dedupe [--no-confirm]
+
+    This command will find groups of entries whose values are the
+    same once normalized, show each group, and ask which value to
+    keep. The group will be merged into one entry with that value,
+    all of the tags, the earliest created time, the latest accessed
+    time, and the sum of the access counts. With --no-confirm, every
+    group will be merged, keeping the most-accessed value.
+
+    The "normalizers" config lists how values are normalized, which
+    also applies to checking for duplicates on create:
+      whitespace: trim the ends and collapse runs of whitespace
+      case: ignore upper/lower case
+      url: ignore http vs https, host case, default ports, and
+           trailing slashes
+
+
+  RETAGGING
+    $ star [--no-confirm] --retag old new
+    $ star [--no-confirm] --merge-tags tag1 tag2[ tag...] --into tag
+    $ star [--no-confirm] --drop-tag tag[ tag...]
+
+    These commands will rename a tag, merge tags into one, or drop
+    tags, in every entry in the store. The number of entries that will
+    change is shown first, and you'll be asked to continue, unless you
+    give --no-confirm. The changes are recorded in the journal, so
+    they can be undone.
+
+
+  ALIASING TAGS
+    $ star --aliases
+    $ star --alias tag alias[ alias...]
+    $ star --unalias alias[ alias...]
+
+    These commands will list the tag aliases, add aliases to a tag,
+    or remove aliases (or, given a tag, all of its aliases). Aliases
+    are saved under "tag_aliases" in the config file, like:
+      tag_aliases:
+        kubernetes: [k8s, kube]
+
+    A search for a tag or any of its aliases matches them all, so
+    "k8s" and "tag:kube" both find entries tagged "kubernetes". If
+    "canonicalize_tags" is true, aliases are replaced by their tag
+    when entries are created or edited.
+
 
   SEARCHING & ACTING
     $ star [flags] term[ term...]
@@ -32,39 +216,130 @@ func printUsageInformation() {
     FLAGS
       -1, --one-line  Print output compressed to one line.
       -2, --two-line  Print output on two lines (value, tags).
+      -3, --three-line
+                      Print output on two lines plus notes.
       -a, --asc       Print records in ascending order.
       -b, --browse    Browse (do not select and pipe value to external tool).
+      -c, --copy      Copy the value of the selected record(s) to the clipboard.
       -d, --desc      Print output in descending order.
       -e, --edit      Edit the specified entries in your $EDITOR.
+      --force         With -n, create the entry even if its value exists.
       -h, ---help     Print this help message.
       -i, --init      Initialize.
+      --include-expired
+                      Include expired entries in the results.
       -l, --loose     Match loosely.
       -n, --new       Create an entry.
+      --stdin         With -n, read the value from stdin.
+      --editor        With -n, read the value from your editor.
+      --no-confirm    Make changes without showing them and asking first:
+                      edits, --dedupe, --gc, --empty-trash, tag renames,
+                      merges and drops, --repair, and --restore-backup.
       -p, --pipe      Pipe the value of the selected record to external tool.
+      -P, --pipe-to 'tool[ args...]'
+                      Pipe the value of the selected record to the given tool
+                      instead of the "pipe_to" tool.
+      --pipe-mode (each|join|json)
+                      Pipe in the given mode instead of the "pipe_mode".
       -s, --strict    Match strictly.
+      -t, --tags      List the tags of the matching records as a tree.
       -x, --delete    Delete the selected record(s).
+      --pin           Pin the selected record(s).
+      --unpin         Unpin the selected record(s).
+      --tag-add tag[,tag...]
+                      Add the given tags to the selected record(s).
+      --tag-remove tag[,tag...]
+                      Remove the given tags from the selected record(s).
+
+    Tags can be hierarchical, with levels separated by slashes, like
+    "lang/go" and "lang/ruby". A search term like "tag:lang" matches
+    records tagged "lang" or any tag under it. Other terms match the
+    text of values and tags. Renaming, merging, or dropping a tag
+    does the same to the tags under it.
+
+    Pinned records are marked with a star and always listed first.
+    A search term like "is:pinned" matches only pinned records.
 
     Searching is the default action. If no flags are given, the match
     mode (strict or loose) and action to take (external tool to pipe
     the value to) will be read from '~/.config/star/config.yaml'.
     Keys read from the config file are:
       store_file: ~/path/to/store/file
+      archive_file: ~/path/to/archive/file
+      backup_dir: ~/path/to/backup/directory
+      backup_count: count
+      backup_days: days
+      include_expired: (true|false)
       filter_mode: (strict|loose)
+      on_duplicate: (ask|merge|create|skip|abort)
+      normalizers: [whitespace, case, url]
       editor: /path/to/editor
-      print_lines: (1|2)
+      edit_format: (text|yaml|json)
+      print_lines: (1|2|3)
+      search_notes: (true|false)
       sort_order: (asc|desc)
-      pipe_to: /path/to/tool
+      pipe_to: /path/to/tool[ args...]
+      pipe_mode: (each|join|json)
+      pipe_separator: (newline|nul|tab)
+      pipe_timeout: seconds
+      clipboard: (auto|wl-copy|xclip|xsel|pbcopy|osc52)
+      clipboard_clear: seconds
+      canonicalize_tags: (true|false)
+      tag_aliases: {tag: [alias, ...], ...}
+      trash_days: days
 
     If values are missing, these defaults will be used:
       store_file: ~/.config/star/store
+      archive_file: the store file's path plus ".archive"
+      backup_dir: "backups", next to the store file
+      backup_count: 10
+      backup_days: 0
+      include_expired: false
       filter_mode: loose
+      on_duplicate: ask
+      normalizers: [whitespace]
       editor: $EDITOR or /usr/bin/vi
+      edit_format: text
       print_lines: 2
+      search_notes: false
       sort_order: desc
       pipe_to: {none}
+      pipe_mode: join
+      pipe_separator: newline
+      pipe_timeout: 0 (no limit)
+      clipboard: auto
+      clipboard_clear: 0 (never)
+      canonicalize_tags: false
+      tag_aliases: {none}
+      trash_days: 0 (forever)
 
     If no "pipe_to" action is present, then records will be printed
     to stdout.
+
+    The "pipe_mode" determines how the values of the selected records
+    are passed to the "pipe_to" tool on stdin. In "each" mode, the
+    tool is run once per record. In "join" mode, it's run once with
+    the values joined by the "pipe_separator". In "json" mode, it's
+    run once with the values as a JSON array. When more than one
+    record is piped, a summary of which succeeded will be printed.
+    If the tool's command line contains "{}", that will be replaced by
+    the value(s) rather than writing them to stdin, as in 'open {}'.
+    If the tool fails or runs longer than "pipe_timeout" seconds, its
+    command line, exit code, and the end of its stderr are printed,
+    and the records it failed on won't be marked as accessed.
+
+    The "edit_format" determines how records are written to the file
+    opened in your editor by --edit. The "yaml" and "json" formats
+    include each record's id and metadata, can represent any value,
+    and are checked strictly when read back. If the file can't be
+    read, no changes are saved and the file is kept.
+
+    The --copy action doesn't need a "pipe_to" tool. With "clipboard"
+    set to "auto", it will use wl-copy, xclip, xsel, or pbcopy, if
+    one is available, or else the OSC 52 terminal escape sequence,
+    which also works over SSH. If "clipboard_clear" is more than zero,
+    the clipboard will be cleared after that many seconds, as long as
+    it still holds the copied value.
 `
 
 	fmt.Println(msg)
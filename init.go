@@ -4,13 +4,29 @@ package main
 // makeInitializer returns a main action function that will
 // initialize the user's config and store files. If the user
 // specifies a file path on the command line as the first argument,
-// that file will be used for their store file.
+// that file will be used for their store file, else the one in their
+// config, or the default, will be. A new store file gets
+// the current version's header, and an existing one in an older
+// version is migrated.
 func makeInitializer(terms []string) func() {
 	init := func() {
 		checkConfigFile()
 		conf := readConfig()
-		conf.Store = checkStoreFile(terms[0], defaultStoreFilePath())
+		store := conf.Store
+		if len(terms) > 0 {
+			store = terms[0]
+		}
+		// The archive file and backup directory that were derived from
+		// the old store path are derived again from the new one.
+		if conf.ArchiveFile == archiveFilePath(conf.Store) {
+			conf.ArchiveFile = ""
+		}
+		if conf.BackupDir == backupDirPath(conf.Store) {
+			conf.BackupDir = ""
+		}
+		conf.Store = checkStoreFile(store, defaultStoreFilePath())
 		mergeConfigWithDefaults(conf)
+		migrateStoreFile(conf)
 		saveConfigToFile(conf)
 	}
 
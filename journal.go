@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+
+// JournalEntry is a structure that records one operation on the
+// store: what it was, when it happened, and the Records it changed,
+// as they were before and after. The first Pairs Records in Before
+// were changed into the first Pairs Records in After, and the rest
+// of Before were removed and the rest of After were added. Undoing
+// the operation means putting the Before Records back in place of
+// the After Records. Undone entries can be redone until another
+// operation is recorded.
+type JournalEntry struct {
+	Time int64 `json:"time"`
+	Op string `json:"op"`
+	Pairs int `json:"pairs,omitempty"`
+	Before []Record `json:"before"`
+	After []Record `json:"after"`
+	Undone bool `json:"undone,omitempty"`
+}
+
+// JournalHistoryLength is the number of operations shown by
+// `--history` unless another number is given.
+const JournalHistoryLength = 10
+
+// JournalMaxSize is the size, in bytes, past which the journal is
+// trimmed. The oldest entries are dropped until it's at most half
+// this size, so it isn't trimmed again on each operation.
+const JournalMaxSize = 8 * 1024 * 1024
+
+
+// journalFilePath returns the path to the journal for the store file
+// named by the given string. It's kept next to the store.
+func journalFilePath(store string) string {
+	return store + ".journal"
+}
+
+// makeHistoryLister returns the History main action function, which
+// prints the most recent operations in the journal, newest first. If
+// a term is given, it's the number of operations to print.
+func makeHistoryLister(conf *Config, terms []string) func() {
+	lister := func() {
+		count := JournalHistoryLength
+		if len(terms) > 0 {
+			n, err := strconv.Atoi(terms[0])
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "To list the most recent operations:\n  $ star --history[ count]\n")
+				return
+			}
+			count = n
+		}
+
+		entries := readJournalEntries(conf.Store)
+		if len(entries) == 0 {
+			fmt.Printf("No operations have been recorded.\n")
+			return
+		}
+
+		for o := len(entries) - 1; o >= 0 && count > 0; o-- {
+			fmt.Printf("%v) %v\n", (o + 1), describeJournalEntry(entries[o]))
+			count--
+		}
+	}
+
+	return lister
+}
+
+// makeUndoer returns the Undo main action function, which reverts the
+// most recent operation in the journal that hasn't been undone.
+func makeUndoer(conf *Config) func() {
+	undoer := func() {
+		entries := readJournalEntries(conf.Store)
+
+		o := len(entries) - 1
+		for o >= 0 && entries[o].Undone {
+			o--
+		}
+		if o < 0 {
+			fmt.Printf("Nothing to undo.\n")
+			return
+		}
+
+		if !applyJournalEntry(conf, entries[o], true) {
+			return
+		}
+
+		entries[o].Undone = true
+		writeJournalEntries(conf.Store, entries)
+		fmt.Printf("Undid %v.\n", describeJournalEntry(entries[o]))
+	}
+
+	return undoer
+}
+
+// makeRedoer returns the Redo main action function, which repeats the
+// earliest operation in the journal that has been undone.
+func makeRedoer(conf *Config) func() {
+	redoer := func() {
+		entries := readJournalEntries(conf.Store)
+
+		o := 0
+		for o < len(entries) && !entries[o].Undone {
+			o++
+		}
+		if o == len(entries) {
+			fmt.Printf("Nothing to redo.\n")
+			return
+		}
+
+		if !applyJournalEntry(conf, entries[o], false) {
+			return
+		}
+
+		entries[o].Undone = false
+		writeJournalEntries(conf.Store, entries)
+		fmt.Printf("Redid %v.\n", describeJournalEntry(entries[o]))
+	}
+
+	return redoer
+}
+
+// describeJournalEntry returns a line describing the given entry: its
+// time, its operation, and the number of Records it changed.
+func describeJournalEntry(entry JournalEntry) string {
+	var counts []string
+	if entry.Pairs > 0 {
+		counts = append(counts, "changed " + pluralize(entry.Pairs, "entry", "entries"))
+	}
+	if n := len(entry.Before) - entry.Pairs; n > 0 {
+		counts = append(counts, "removed " + pluralize(n, "entry", "entries"))
+	}
+	if n := len(entry.After) - entry.Pairs; n > 0 {
+		counts = append(counts, "added " + pluralize(n, "entry", "entries"))
+	}
+
+	desc := fmt.Sprintf("%v %v: %v", time.Unix(entry.Time, 0).Format(TrashTimeFormat), entry.Op, strings.Join(counts, ", "))
+	if entry.Undone {
+		desc += " (undone)"
+	}
+
+	return desc
+}
+
+// applyJournalEntry reverts the given entry's operation on the store
+// if `undo` is true, or else repeats it. Changed Records are put back
+// in their places in the store. Records that were moved to the trash
+// or the archive are moved back too. If the store no longer has the
+// Records the operation left, or had before it, nothing is changed
+// and it returns false.
+func applyJournalEntry(conf *Config, entry JournalEntry, undo bool) bool {
+	from, to := entry.Before, entry.After
+	if undo {
+		from, to = entry.After, entry.Before
+	}
+
+	missing := append([]Record{}, from...)
+	forEachRecordInFile(conf.Store, func(record Record) {
+		if n := findRecordIndex(missing, record); n >= 0 {
+			missing = removeRecord(missing, n)
+		}
+	})
+	if len(missing) > 0 {
+		fmt.Fprintf(os.Stderr, "The entries changed by that operation have changed since. No changes saved.\n")
+		return false
+	}
+
+	removed, added := from[entry.Pairs:], to[entry.Pairs:]
+
+	// The deletions in these operations went to the trash or the
+	// archive, so the Records are put back there or taken from there
+	// too. They're put back before the store is changed and taken
+	// after, so if either fails, nothing is lost.
+	switch {
+	case entry.Op == "gc" && !undo:
+		appendRecordsToFile(conf.ArchiveFile, removed)
+	case (entry.Op == "delete" || entry.Op == "edit") && !undo:
+		moveRecordsToTrash(conf, removed)
+	case entry.Op == "restore" && undo:
+		moveRecordsToTrash(conf, removed)
+	}
+
+	pending := append([]Record{}, from...)
+	replacements := make([]Record, len(from))
+	copy(replacements, to[:entry.Pairs])
+
+	updateStore(conf, func(bk_file *os.File, record Record) {
+		n := findRecordIndex(pending, record)
+		if n < 0 {
+			saveRecordToFile(bk_file, record)
+			return
+		}
+		// Matched Records are blanked out rather than removed so the
+		// indices keep lining up with the replacements.
+		pending[n] = Record{}
+		if n < entry.Pairs {
+			saveRecordToFile(bk_file, replacements[n])
+		}
+	})
+
+	if len(added) > 0 {
+		appendRecordsToFile(conf.Store, added)
+	}
+
+	switch {
+	case entry.Op == "gc" && undo:
+		removeRecordsFromFile(conf.ArchiveFile, added)
+	case (entry.Op == "delete" || entry.Op == "edit") && undo:
+		removeRecordsFromTrash(conf.Store, added)
+	case entry.Op == "restore" && !undo:
+		removeRecordsFromTrash(conf.Store, added)
+	}
+
+	return true
+}
+
+// findRecordIndex returns the index of the first Record in the given
+// slice with the same value and tags as the given Record, or -1.
+func findRecordIndex(records []Record, record Record) int {
+	for n, chk := range records {
+		if ((chk.Value == record.Value) && (reflect.DeepEqual(chk.Tags, record.Tags))) {
+			return n
+		}
+	}
+	return -1
+}
+
+// removeRecordsFromFile removes the given Records from the store-like
+// file named by the given string, if it exists.
+func removeRecordsFromFile(file_name string, records []Record) {
+	if len(records) == 0 || !doesFileExist(file_name) {
+		return
+	}
+
+	pending := append([]Record{}, records...)
+	updateStoreFile(file_name, func(bk_file *os.File, record Record) {
+		if n := findRecordIndex(pending, record); n >= 0 {
+			pending = removeRecord(pending, n)
+		} else {
+			saveRecordToFile(bk_file, record)
+		}
+	})
+}
+
+// appendJournalEntry adds an entry for the named operation, which
+// changed the given Before Records into the given After Records, to
+// the journal for the given store file. The first `pairs` Records in
+// each were changed one into the other. Each entry is one line of
+// JSON. Since the new operation can't follow operations that have
+// been undone, those can no longer be redone, and they're dropped.
+// Usually the line is just appended, and the journal is only read
+// and rewritten when there are undone entries to drop or when it
+// passes `JournalMaxSize`.
+func appendJournalEntry(store string, op string, pairs int, before []Record, after []Record) {
+	if len(before) == 0 && len(after) == 0 {
+		return
+	}
+
+	entry := JournalEntry{time.Now().Unix(), op, pairs, before, after, false}
+	line, err := json.Marshal(entry)
+	checkForError(err)
+
+	journal_name := journalFilePath(store)
+	var size int64
+	if info, err := os.Stat(journal_name); err == nil {
+		size = info.Size()
+	}
+
+	// Undone entries are only ever at the end of the journal, so if
+	// the last one isn't undone, none are.
+	var last JournalEntry
+	undone := size > 0 && json.Unmarshal(readLastLine(journal_name), &last) == nil && last.Undone
+
+	if undone || size + int64(len(line)) > JournalMaxSize {
+		entries := readJournalEntries(store)
+		o := len(entries)
+		for o > 0 && entries[o - 1].Undone {
+			o--
+		}
+		writeJournalEntries(store, trimJournalEntries(append(entries[:o], entry)))
+		return
+	}
+
+	appendJSONLine(journal_name, line)
+}
+
+// trimJournalEntries returns the given entries without the oldest, if
+// they'd make the journal bigger than `JournalMaxSize`, until it's at
+// most half that. The newest entry is always kept.
+func trimJournalEntries(entries []JournalEntry) []JournalEntry {
+	var size int64
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		checkForError(err)
+		size += int64(len(line) + 1)
+	}
+	if size <= JournalMaxSize {
+		return entries
+	}
+
+	o := 0
+	for size > JournalMaxSize / 2 && o < len(entries) - 1 {
+		line, err := json.Marshal(entries[o])
+		checkForError(err)
+		size -= int64(len(line) + 1)
+		o++
+	}
+
+	return entries[o:]
+}
+
+// readJournalEntries reads the entries in the journal for the given
+// store file, oldest first. Lines that can't be read are skipped.
+func readJournalEntries(store string) []JournalEntry {
+	var entries []JournalEntry
+	readJSONLines(journalFilePath(store), func(line []byte) {
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	})
+
+	return entries
+}
+
+// writeJournalEntries replaces the journal for the given store file
+// with the given entries.
+func writeJournalEntries(store string, entries []JournalEntry) {
+	values := make([]interface{}, len(entries))
+	for o, entry := range entries {
+		values[o] = entry
+	}
+	writeJSONLines(journalFilePath(store), values)
+}
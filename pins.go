@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+
+// MetaPinned is added to a Record's metadata, after the created and
+// accessed times and the access count, to pin it. Records that
+// aren't pinned have just the three, as they always have.
+const MetaPinned = "pinned"
+
+// IsTermPrefix marks a search term that matches a record's state
+// rather than its text, as in `is:pinned`.
+const IsTermPrefix = "is:"
+
+
+// makePinner makes the Pin search action function: the returned
+// function will receive the slice of wanted Records and pin them or,
+// if `pin` is false, unpin them. The changes are saved in one pass
+// over the store.
+func makePinner(conf *Config, pin bool) func([]Record) {
+	pinner := func(records []Record) {
+		var edits [][]Record
+
+		for _, record := range records {
+			if isRecordPinned(record) != pin {
+				edits = append(edits, []Record{record, setRecordPinned(record, pin)})
+			}
+		}
+
+		if len(edits) == 0 {
+			fmt.Printf("No changes.\n")
+			return
+		}
+
+		if pin {
+			saveEditsToStore(conf, "pin", nil, edits, nil)
+		} else {
+			saveEditsToStore(conf, "unpin", nil, edits, nil)
+		}
+
+		if pin {
+			fmt.Printf("Pinned %v.\n", pluralize(len(edits), "entry", "entries"))
+		} else {
+			fmt.Printf("Unpinned %v.\n", pluralize(len(edits), "entry", "entries"))
+		}
+	}
+
+	return pinner
+}
+
+// isRecordPinned checks if the given Record's metadata pins it.
+func isRecordPinned(record Record) bool {
+	return len(record.Meta) > 3 && record.Meta[3] == MetaPinned
+}
+
+// setRecordPinned returns a copy of the given Record, pinned or not.
+// The metadata is copied, so the given Record's isn't changed.
+func setRecordPinned(record Record, pin bool) Record {
+	record.Meta = formatRecordMeta(parseRecordMeta(record.Meta))
+	if pin {
+		record.Meta = append(record.Meta, MetaPinned)
+	}
+	return record
+}
+
+// sortPinnedFirst moves the pinned Records in the given slice to the
+// front of it. The order is otherwise kept.
+func sortPinnedFirst(records []Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return isRecordPinned(records[i]) && !isRecordPinned(records[j])
+	})
+}
+
+// countStateMatches returns 1 if the given Record is in the given
+// state, like "pinned" or "expired", and 0 if it isn't.
+func countStateMatches(record Record, state string) int {
+	switch {
+	case state == MetaPinned && isRecordPinned(record):
+		return 1
+	case state == MetaExpired && isRecordExpired(record, time.Now()):
+		return 1
+	default:
+		return 0
+	}
+}
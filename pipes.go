@@ -1,72 +1,403 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-	// "io/ioutil"
 	"os"
 	"os/exec"
-	//"strings"
-	"unicode/utf8"
+	"strings"
+	"time"
 )
 
 
+// PipeAction is a structure that describes an external tool that
+// the values of the wanted Records can be piped to. The Mode says
+// how the values will be passed to the tool: once per Record, all
+// joined by the Separator in a single invocation, or as a JSON array
+// in a single invocation.
+type PipeAction struct {
+	Command string
+	Mode string
+	Separator string
+	Timeout time.Duration
+}
+
+// PipeResult is a structure that pairs the Records that were passed
+// to one invocation of an external tool with the error, if any, that
+// running the tool returned.
+type PipeResult struct {
+	Records []Record
+	Err error
+}
+
+// ToolError is returned when an external tool fails. It contains
+// the command line, the exit code (or -1 if the tool didn't exit on
+// its own), and the last lines the tool wrote to stderr.
+type ToolError struct {
+	Command string
+	ExitCode int
+	Stderr []string
+	Err error
+}
+
+// TailBuffer is an io.Writer that keeps only the last Max bytes
+// written to it.
+type TailBuffer struct {
+	Max int
+	buf []byte
+}
+
+// PipeTemplateMarker is replaced by the piped values when it appears
+// in a PipeAction's command line, as in `open {}`.
+const PipeTemplateMarker = "{}"
+
+// ToolStderrTailSize is the number of bytes of a tool's stderr to
+// keep, and ToolStderrTailLines the number of lines of that to
+// include in the error report.
+const ToolStderrTailSize = 4096
+const ToolStderrTailLines = 5
+
+// These are the valid values for a PipeAction's Mode.
+const (
+	PipeModeEach = "each"
+	PipeModeJoin = "join"
+	PipeModeJSON = "json"
+)
+
+
+// makePipeAction returns a pointer to a PipeAction built from the
+// pipe-related values in the given Config.
+func makePipeAction(conf *Config) *PipeAction {
+	return &PipeAction{conf.Action, conf.PipeMode, pipeSeparatorChar(conf.PipeSeparator), time.Duration(conf.PipeTimeout) * time.Second}
+}
+
+// Error returns the ToolError's message.
+func (e *ToolError) Error() string {
+	return fmt.Sprintf("`%v`: %v", e.Command, e.Err)
+}
+
+// Write appends the given bytes to the TailBuffer, dropping the
+// oldest bytes beyond its Max.
+func (t *TailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if over := len(t.buf) - t.Max; over > 0 {
+		t.buf = t.buf[over:]
+	}
+	return len(p), nil
+}
+
+// Lines returns up to the given number of the last non-empty lines
+// in the TailBuffer.
+func (t *TailBuffer) Lines(max int) []string {
+	var lines []string
+	for _, line := range strings.Split(string(t.buf), "\n") {
+		if trimmed := strings.TrimRight(line, "\r "); trimmed != "" {
+			lines = append(lines, trimmed)
+		}
+	}
+
+	if len(lines) > max {
+		lines = lines[len(lines) - max:]
+	}
+	return lines
+}
+
+// pipeSeparatorChar returns the string that the given separator name
+// stands for.
+func pipeSeparatorChar(name string) string {
+	switch {
+	case name == "nul":
+		return "\x00"
+	case name == "tab":
+		return "\t"
+	default:
+		return "\n"
+	}
+}
+
 // makeRecordPiper makes the Pipe search action function: the
 // returned function will receive the slice of wanted Records and
-// pipe the values of each to an external tool.
-func makeRecordPiper(act string, caller func([]Record, string)) func([]Record) {
-	piper := func(records []Record) {
-		caller(records, act)
+// pipe their values to the external tool described by the given
+// PipeAction, then print a summary of what succeeded. It returns the
+// Records that were piped successfully.
+func makeRecordPiper(pipe *PipeAction) func([]Record) []Record {
+	piper := func(records []Record) []Record {
+		results := pipeRecords(records, pipe)
+		printPipeSummary(pipe, results)
+
+		var piped []Record
+		for _, result := range results {
+			if result.Err == nil {
+				piped = append(piped, result.Records...)
+			}
+		}
+		return piped
 	}
 	return piper
 }
 
-// pipeRecordsAsStdin pipes the given Records to the tool named by the
-// given path on stdin.
-func pipeRecordsAsStdin(records []Record, tool string) {
-	cmd := exec.Command(tool)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	stdin, err := cmd.StdinPipe()
+// pipeRecords pipes the values of the given Records to the tool
+// described by the given PipeAction according to its Mode. It
+// returns one PipeResult for each time the tool was run.
+func pipeRecords(records []Record, pipe *PipeAction) []PipeResult {
+	var results []PipeResult
+
+	if pipe.Mode == PipeModeEach {
+		for _, record := range records {
+			group := []Record{record}
+			results = append(results, PipeResult{group, pipeRecordsToTool(group, pipe)})
+		}
+	} else {
+		results = append(results, PipeResult{records, pipeRecordsToTool(records, pipe)})
+	}
+
+	return results
+}
+
+// makePipeInput returns the string that will be passed to the tool
+// for the given Records. In the JSON mode, that will be an array of
+// the values. Else, the values will be joined by the PipeAction's
+// Separator.
+func makePipeInput(records []Record, pipe *PipeAction) string {
+	values := make([]string, len(records))
+	for o, record := range records {
+		values[o] = record.Value
+	}
+
+	if pipe.Mode == PipeModeJSON {
+		out, err := json.Marshal(values)
+		checkForError(err)
+		return string(out)
+	}
+
+	return strings.Join(values, pipe.Separator)
+}
+
+// pipeRecordsToTool runs the command line in the given PipeAction
+// for the given Records. If the command line contains the template
+// marker, the input from `makePipeInput` will replace it in the
+// arguments. Else, the input, followed by the Separator (or newline,
+// for JSON), will be written to the tool's stdin. If the tool fails,
+// an error message will be printed and the error will be returned.
+func pipeRecordsToTool(records []Record, pipe *PipeAction) error {
+	args := splitCommandLine(pipe.Command)
+	if len(args) == 0 {
+		err := fmt.Errorf("no command given")
+		fmt.Fprintf(os.Stderr, "Error running `%v`: %v\n", pipe.Command, err)
+		return err
+	}
+
+	input := makePipeInput(records, pipe)
+
+	var stdin io.Reader
+	if filled, ok := fillCommandTemplate(args, input); ok {
+		args = filled
+		stdin = strings.NewReader("")
+	} else if pipe.Mode == PipeModeJSON {
+		stdin = strings.NewReader(input + "\n")
+	} else {
+		stdin = strings.NewReader(input + pipe.Separator)
+	}
+
+	err := runTool(args, stdin, pipe.Timeout, true)
 	if err != nil {
-		panic("Failed to open stdin pipe for records!")
+		printToolError(err)
 	}
 
-	defer func() {
-		for _, record := range records {
-			io.WriteString(stdin, record.Value + "\n")
+	return err
+}
+
+// fillCommandTemplate replaces each occurrence of the template marker
+// in the given arguments with the given input. The bool will be true
+// if any argument contained the marker.
+func fillCommandTemplate(args []string, input string) ([]string, bool) {
+	filled := make([]string, len(args))
+	found := false
+
+	for o, arg := range args {
+		if strings.Contains(arg, PipeTemplateMarker) {
+			found = true
 		}
-		stdin.Close() // Close the pipe, thereby sending EOF.
-		if err := cmd.Run(); err != nil {
-			fmt.Fprintln(os.Stderr, err)
+		filled[o] = strings.Replace(arg, PipeTemplateMarker, input, -1)
+	}
+
+	return filled, found
+}
+
+// printPipeSummary prints a line for each Record that was piped,
+// noting whether the tool succeeded. If the tool ran only once and
+// succeeded, nothing will be printed.
+func printPipeSummary(pipe *PipeAction, results []PipeResult) {
+	total, passed := 0, 0
+	for _, result := range results {
+		total += len(result.Records)
+		if result.Err == nil {
+			passed += len(result.Records)
 		}
-	}()
+	}
+
+	if len(results) < 2 && passed == total {
+		return
+	}
+
+	fmt.Printf("Piped %v of %v records to `%v`.\n", passed, total, pipe.Command)
+	for _, result := range results {
+		for _, record := range result.Records {
+			// The lines of multi-line values are lined up with the
+			// first, after the status column.
+			value := indentValue(record.Value, "          ")
+			if result.Err == nil {
+				fmt.Printf("  ok      %v\n", value)
+			} else {
+				fmt.Printf("  failed  %v\n", value)
+			}
+		}
+	}
 }
 
-// pipeToToolAsArg pipes the given string to the tool named by the
-// given path as an argument, so in the form `tool str`.
-func pipeToToolAsArg(str string, tool string) {
-	cmd := exec.Command(tool, str)
-	printErr := func(err error) {
-		fmt.Fprintf(os.Stderr, "Error running `%v %v`: %v\n", tool, str, err)
+// splitCommandLine splits the given string into a command and its
+// arguments. Arguments are separated by spaces, and single quotes,
+// double quotes, and backslashes can be used to keep spaces in an
+// argument, much like in a shell.
+func splitCommandLine(line string) []string {
+	var args []string
+	var arg strings.Builder
+	in_arg := false
+	quote := rune(0)
+	escaped := false
+
+	for _, char := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(char)
+			escaped = false
+		case char == '\\' && quote != '\'':
+			escaped = true
+			in_arg = true
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(char)
+			}
+		case char == '\'' || char == '"':
+			quote = char
+			in_arg = true
+		case char == ' ' || char == '\t':
+			if in_arg {
+				args = append(args, arg.String())
+				arg.Reset()
+				in_arg = false
+			}
+		default:
+			arg.WriteRune(char)
+			in_arg = true
+		}
+	}
+
+	if in_arg {
+		args = append(args, arg.String())
 	}
-	runCommand(cmd, printErr)
+
+	return args
 }
 
-// runCommand runs the given Command and checks for an error. If an
-// error occurs, it gets passed to the given handler function.
-func runCommand(cmd *exec.Cmd, printErr func(error)) {
-	var out bytes.Buffer
-	cmd.Stdout = &out
+// pipeToToolAsArg runs the tool named by the given command line
+// with the given string appended as an argument, so in the form
+// `tool str`. The tool is connected to the terminal, so this works
+// for interactive tools like editors. If the tool fails, an error
+// message will be printed and the error will be returned.
+func pipeToToolAsArg(str string, tool string) error {
+	args := append(splitCommandLine(tool), str)
 
-	err := cmd.Run()
+	err := runTool(args, os.Stdin, 0, false)
+	if err != nil {
+		printToolError(err)
+	}
+
+	return err
+}
+
+// runTool runs the command given by the slice of arguments, with the
+// given Reader as its stdin. Its stdout and stderr pass through to
+// ours. If `keep_stderr` is true, the end of its stderr will also be
+// kept for the error report. That should be false for tools that
+// leave a process running in the background (like xclip), because
+// reading their stderr would wait for that process to exit. If the
+// timeout is more than zero, the command will be killed after that
+// long. If the command fails, the returned error will be a ToolError.
+func runTool(args []string, stdin io.Reader, timeout time.Duration, keep_stderr bool) error {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = stdin
+	cmd.Stdout = os.Stdout
+
+	tail := &TailBuffer{Max: ToolStderrTailSize}
+	if keep_stderr {
+		cmd.Stderr = io.MultiWriter(os.Stderr, tail)
+	} else {
+		cmd.Stderr = os.Stderr
+	}
+
+	err := cmd.Run()
 	if err == nil {
-		if utf8.RuneCountInString(out.String()) > 0 {
-			fmt.Printf("OUTPUT? %v\n", out.String())
+		return nil
+	}
+
+	tool_err := &ToolError{formatCommandLine(args), -1, tail.Lines(ToolStderrTailLines), err}
+	if ctx.Err() == context.DeadlineExceeded {
+		tool_err.Err = fmt.Errorf("timed out after %v", timeout)
+	} else if exit_err, ok := err.(*exec.ExitError); ok {
+		tool_err.ExitCode = exit_err.ExitCode()
+	}
+
+	return tool_err
+}
+
+// printToolError prints the given error to stderr. If it's a
+// ToolError, the exit code and the end of the tool's stderr will be
+// included.
+func printToolError(err error) {
+	tool_err, ok := err.(*ToolError)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Error running `%v`: %v\n", tool_err.Command, tool_err.Err)
+	if tool_err.ExitCode >= 0 {
+		fmt.Fprintf(os.Stderr, "  exit code: %v\n", tool_err.ExitCode)
+	}
+	for o, line := range tool_err.Stderr {
+		if o == 0 {
+			fmt.Fprintf(os.Stderr, "  stderr: %v\n", line)
+		} else {
+			fmt.Fprintf(os.Stderr, "          %v\n", line)
 		}
-	} else {
-		printErr(err)
 	}
 }
+
+// formatCommandLine joins the given arguments into a string that
+// could be pasted into a shell: arguments containing spaces or
+// quotes will be single-quoted.
+func formatCommandLine(args []string) string {
+	parts := make([]string, len(args))
+
+	for o, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t'\"\\") {
+			parts[o] = "'" + strings.Replace(arg, "'", "'\\''", -1) + "'"
+		} else {
+			parts[o] = arg
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
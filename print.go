@@ -9,11 +9,18 @@ import (
 )
 
 
+// StdoutPrintFormat is the format for printing records to stdout.
+// Pinned records are marked with a star.
+var StdoutPrintFormat = PrintFormat{"%v%v) %v\n%v%v\n", "%v%v\n", "", "", "* ", ""}
+
+
 func getPrinter(act *ActionCode) func([]Record) {
 	if act.Print == PrintValsOnly {
 		return printRecordsValuesOnly
 	} else if (act.Print == PrintCompact) {
 		return printRecordsCompact
+	} else if (act.Print == PrintVerbose) {
+		return listRecordsVerboseToStdout
 	} else {
 		return listRecordsToStdout
 	}
@@ -34,9 +41,28 @@ func makeRecordPrintCaller(printer func([]Record)) func([]Record) {
 	return caller
 }
 
+// PrintFormat holds the format strings used by `printRecordsFull`.
+// The Record format gets the top line's padding, the number, and the
+// value, then the bottom line's padding and the tags. The Attrs and
+// Note formats get the padding and the attributes or note. If the
+// Note format is empty, notes aren't printed. Multi-line values and
+// notes get the Cont prefix on each line after the first, pinned
+// values get the Pin prefix, and Sep is printed after each record.
+type PrintFormat struct {
+	Record string
+	Attrs string
+	Note string
+	Cont string
+	Pin string
+	Sep string
+}
+
+
 // printRecordsFull prints the given slice of Records to the given
-// io.Writer in the given format.
-func printRecordsFull(out io.Writer, records []Record, format string) {
+// io.Writer in the given format. If a value has multiple lines, the
+// lines after the first will be indented to line up with it. If a
+// Record has attributes or a note, those are printed after the rest.
+func printRecordsFull(out io.Writer, records []Record, format PrintFormat) {
 	// This is the number of records.
 	m := len(records)
 	// This is the number of digits in that number.
@@ -51,17 +77,42 @@ func printRecordsFull(out io.Writer, records []Record, format string) {
 			spaces_top += strings.Repeat(" ", v)
 		}
 
-		fmt.Fprintf(out, format,
-			spaces_top, (o + 1), records[o].Value,
+		value := strings.Replace(records[o].Value, "\n", "\n" + spaces_bot + format.Cont, -1)
+		if isRecordPinned(records[o]) {
+			value = format.Pin + value
+		}
+
+		fmt.Fprintf(out, format.Record,
+			spaces_top, (o + 1), value,
 			spaces_bot, strings.Join(records[o].Tags, ", "))
+
+		if len(records[o].Attrs) > 0 {
+			fmt.Fprintf(out, format.Attrs, spaces_bot, strings.Join(records[o].Attrs, ", "))
+		}
+
+		if len(records[o].Note) > 0 && len(format.Note) > 0 {
+			fmt.Fprintf(out, format.Note, spaces_bot, strings.Replace(records[o].Note, "\n", "\n" + spaces_bot + format.Cont, -1))
+		}
+
+		fmt.Fprint(out, format.Sep)
 	}
 }
 
-// printRecordsCompact receives a slice of Records and writes
-// the value of each to stdout.
+// printRecordsCompact receives a slice of Records and writes the
+// value and tags (and attributes, if any) of each to stdout, one per
+// line, with pinned values marked. Line breaks in values are shown
+// as `\n`.
 func printRecordsCompact(records []Record) {
 	for o := 0; o < len(records); o++ {
-		fmt.Fprintf(os.Stdout, "%v {tags: %v}\n", records[o].Value, strings.Join(records[o].Tags, ", "))
+		var attrs string
+		if len(records[o].Attrs) > 0 {
+			attrs = fmt.Sprintf(" {attrs: %v}", strings.Join(records[o].Attrs, ", "))
+		}
+		var pin string
+		if isRecordPinned(records[o]) {
+			pin = StdoutPrintFormat.Pin
+		}
+		fmt.Fprintf(os.Stdout, "%v%v {tags: %v}%v\n", pin, strings.Replace(records[o].Value, "\n", "\\n", -1), strings.Join(records[o].Tags, ", "), attrs)
 	}
 }
 
@@ -74,14 +125,32 @@ func printRecordsValuesOnly(records []Record) {
 }
 
 
+// pluralize returns the given count followed by the singular or
+// plural word, as appropriate.
+func pluralize(count int, one string, many string) string {
+	if count == 1 {
+		return fmt.Sprintf("%v %v", count, one)
+	}
+	return fmt.Sprintf("%v %v", count, many)
+}
+
+
 // listRecordsToStdout is a convenience function for printing the
 // given records to stdout.
 func listRecordsToStdout(records []Record) {
-	printRecordsFull(os.Stdout, records, "%v%v) %v\n%v%v\n")
+	printRecordsFull(os.Stdout, records, StdoutPrintFormat)
+}
+
+// listRecordsVerboseToStdout is like `listRecordsToStdout` but also
+// prints each record's note.
+func listRecordsVerboseToStdout(records []Record) {
+	format := StdoutPrintFormat
+	format.Note = "%v" + colorize("%v", ColorYellow) + "\n"
+	printRecordsFull(os.Stdout, records, format)
 }
 
 // listRecordsToTempFile is a convenience function for printing the
 // given records to the given file handle.
 func listRecordsToTempFile(records []Record, file *os.File) {
-	printRecordsFull(file, records, "%v%v) %v\n%vTags: %v\n\n")
+	printRecordsFull(file, records, PrintFormat{"%v%v) %v\n%vTags: %v\n", "%vAttrs: %v\n", "%vNote: %v\n", EditFileContinuation, "", "\n"})
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -10,13 +12,20 @@ import (
 // A Record is built from a well-formed entry.
 // A well-formed entry has the structure specified in `joinRecord`.
 type Record struct {
-	Value string
-	Tags []string
-	Meta []string
-	MatchRate float64
+	Value string `json:"value"`
+	Tags []string `json:"tags"`
+	Meta []string `json:"meta"`
+	Attrs []string `json:"attrs,omitempty"`
+	Note string `json:"note,omitempty"`
+	MatchRate float64 `json:"-"`
 }
 
 
+// NoteTermPrefix marks a search term that matches notes rather than
+// values and tags, as in `note:deploy`.
+const NoteTermPrefix = "note:"
+
+
 // These are the ASCII Group, Record, and Unit separator characters.
 // They are of type `rune`.
 const GroupSeparator = ''   // Separates records
@@ -29,6 +38,10 @@ const UnitSeparator = ''    // Separates parts of parts (each tag from each tag
 // resulting strings will be joined to the value with the record
 // separator; and the group separator and a newline will be appended
 // to the resulting string. The return will be a well-formed entry.
+// If the Record has attributes, they'll be joined like the tags and
+// follow the metadata, and if it has a note, that will follow them;
+// if not, they're left out, so entries without them look just like
+// they always have.
 func joinRecord(record Record) string {
 	parts := []string{
 		record.Value,
@@ -36,17 +49,25 @@ func joinRecord(record Record) string {
 		strings.Join(record.Tags, string(UnitSeparator)),
 		string(RecordSeparator),
 		strings.Join(record.Meta, string(UnitSeparator)),
-		string(GroupSeparator),
-		"\n",
 	}
 
+	if len(record.Attrs) > 0 || len(record.Note) > 0 {
+		parts = append(parts, string(RecordSeparator), strings.Join(record.Attrs, string(UnitSeparator)))
+	}
+	if len(record.Note) > 0 {
+		parts = append(parts, string(RecordSeparator), record.Note)
+	}
+
+	parts = append(parts, string(GroupSeparator), "\n")
+
 	return strings.Join(parts, "")
 }
 
 // splitEntry receives a string and returns a slice of strings. The
 // `entry` should still contain the trailing group separator (which
 // splits entries). The string will be split on the record separator.
-// If the entry is well-formed, the return will have three parts.
+// If the entry is well-formed, the return will have three to five
+// parts.
 func splitEntry(entry string) []string {
 	fields := strings.Split(strings.TrimSuffix(entry, string(GroupSeparator)), string(RecordSeparator))
 	return fields
@@ -61,17 +82,92 @@ func splitField(field string) []string {
 }
 
 // makeRecordFromParts receives a slice of strings and returns a
-// Record. The slice should be a well-formed entry: a string, and two
-// a lists of strings joined by the unit separator.
+// Record. The slice should be a well-formed entry: a string, two or
+// three lists of strings joined by the unit separator, and maybe
+// another string.
 func makeRecordFromParts(entry []string) Record {
-	return Record{entry[0], splitField(entry[1]), splitField(entry[2]), 0.0}
+	var attrs []string
+	if len(entry) > 3 && entry[3] != "" {
+		attrs = splitField(entry[3])
+	}
+
+	var note string
+	if len(entry) > 4 {
+		note = entry[4]
+	}
+
+	return Record{entry[0], splitField(entry[1]), splitField(entry[2]), attrs, note, 0.0}
+}
+
+// parseRecordMeta returns the parts of the given Record metadata:
+// the Unix times the Record was created and last accessed, and its
+// access count. Parts that are missing or malformed will be zero.
+func parseRecordMeta(meta []string) (int64, int64, int) {
+	var created, accessed int64
+	var count int
+
+	if len(meta) > 0 {
+		created, _ = strconv.ParseInt(meta[0], 10, 64)
+	}
+	if len(meta) > 1 {
+		accessed, _ = strconv.ParseInt(meta[1], 10, 64)
+	}
+	if len(meta) > 2 {
+		count, _ = strconv.Atoi(meta[2])
+	}
+
+	return created, accessed, count
+}
+
+// formatRecordMeta is the reverse of `parseRecordMeta`.
+func formatRecordMeta(created int64, accessed int64, count int) []string {
+	return []string{strconv.FormatInt(created, 10), strconv.FormatInt(accessed, 10), strconv.Itoa(count)}
+}
+
+// checkNote returns an error if the given note can't be saved: if it
+// contains a separator character.
+func checkNote(note string) error {
+	if hasSeparators(note) {
+		return fmt.Errorf("the note contains an ASCII separator character")
+	}
+	return nil
+}
+
+// checkRecordText returns an error if any text in the given Record
+// can't be saved: if the value is blank, or if the value, a tag, an
+// attribute, or the note contains a separator character.
+func checkRecordText(record Record) error {
+	if err := checkNewValue(record.Value); err != nil {
+		return err
+	}
+
+	for _, tag := range record.Tags {
+		if hasSeparators(tag) {
+			return fmt.Errorf("the tag `%v` contains an ASCII separator character", strings.TrimSpace(removeSeparators(tag)))
+		}
+	}
+
+	for _, attr := range record.Attrs {
+		if hasSeparators(attr) {
+			return fmt.Errorf("an attribute contains an ASCII separator character")
+		}
+	}
+
+	return checkNote(record.Note)
+}
+
+// hasSeparators checks if the given string contains any of the
+// separator characters, which would break the entry it's saved in.
+func hasSeparators(str string) bool {
+	return strings.ContainsAny(str, string([]rune{GroupSeparator, RecordSeparator, UnitSeparator}))
 }
 
 // doesEntryHaveParts receives a slice of strings and returns a bool
-// indicating whether the slice contains three parts. A well-formed
-// entry has three parts: the value, tags, and metadata.
+// indicating whether the slice contains three to five parts. A well-
+// formed entry has three parts: the value, tags, and metadata, and
+// maybe a fourth and fifth: the attributes and the note.
 func doesEntryHaveParts(entry []string) bool {
-	if (len(entry) == 3) {
+	if (len(entry) >= 3 && len(entry) <= 5) {
 		return true
 	} else {
 		return false
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+
+// makeRetagger returns the Retag main action function, which renames,
+// merges, or drops tags across the whole store, depending on the
+// action code's TagOp:
+//   rename: the terms are the old tag and the new tag
+//   merge:  the terms are the tags to merge, then `--into` and the tag
+//           to merge them into
+//   drop:   the terms are the tags to drop
+// Since tags are hierarchical, each tag's children are renamed,
+// merged, or dropped with it. The number of affected records is
+// shown first and, unless the action code says not to confirm, the
+// user is asked before the store is changed. The changes are made in
+// one pass over the store and recorded in the journal.
+func makeRetagger(conf *Config, act *ActionCode, terms []string) func() {
+	retagger := func() {
+		desc, retag, err := makeTagChanger(act.TagOp, terms)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return
+		}
+
+		var before []Record
+		forEachRecordInFile(conf.Store, func(record Record) {
+			if !reflect.DeepEqual(retag(record.Tags), record.Tags) {
+				before = append(before, record)
+			}
+		})
+
+		if len(before) == 0 {
+			fmt.Printf("No entries have those tags.\n")
+			return
+		}
+
+		fmt.Printf("Will %v in %v.\n", desc, pluralize(len(before), "entry", "entries"))
+		if !act.NoConfirm && promptForChoice("Continue? (y/N) ", []string{"yes", "no"}, "no") != "yes" {
+			fmt.Printf("No changes saved.\n")
+			return
+		}
+
+		changed, after := saveRetagsToStore(conf, retag)
+		appendJournalEntry(conf.Store, act.TagOp + "-tags", len(after), changed, after)
+		fmt.Printf("Updated %v.\n", pluralize(len(after), "entry", "entries"))
+	}
+
+	return retagger
+}
+
+// makeTagger makes the Tag search action function: the returned
+// function will receive the slice of wanted Records and add the given
+// tags to each, or remove them, depending on the given operation
+// ("add" or "remove"). The changes are saved in one pass over the
+// store, and the Records' metadata is kept.
+func makeTagger(conf *Config, op string, tags []string) func([]Record) {
+	if conf.CanonicalizeTags {
+		tags = canonicalizeTags(conf.TagAliases, tags)
+	}
+
+	tagger := func(records []Record) {
+		var edits [][]Record
+
+		for _, record := range records {
+			new_rec := record
+			if op == "add" {
+				new_rec.Tags = mergeTags(record.Tags, tags)
+			} else {
+				new_rec.Tags = removeTags(record.Tags, tags)
+			}
+
+			if !reflect.DeepEqual(dedupeTags(new_rec.Tags), dedupeTags(record.Tags)) {
+				edits = append(edits, []Record{record, new_rec})
+			}
+		}
+
+		if len(edits) == 0 {
+			fmt.Printf("No changes.\n")
+			return
+		}
+
+		saveEditsToStore(conf, "tag-" + op, nil, edits, nil)
+		fmt.Printf("Updated %v.\n", pluralize(len(edits), "entry", "entries"))
+	}
+
+	return tagger
+}
+
+// removeTags returns the tags in `tags` that aren't in `unwanted`.
+func removeTags(tags []string, unwanted []string) []string {
+	ref := make(map[string]bool)
+	for _, tag := range unwanted {
+		ref[tag] = true
+	}
+
+	var kept []string
+	for _, tag := range tags {
+		if !ref[tag] {
+			kept = append(kept, tag)
+		}
+	}
+
+	return kept
+}
+
+// makeTagChanger returns a description of the given tag operation on
+// the given terms and a function that applies it to a slice of tags.
+// If the terms don't suit the operation, an error is returned.
+func makeTagChanger(op string, terms []string) (string, func([]string) []string, error) {
+	var from []string
+	var to string
+
+	switch {
+	case op == "rename":
+		if len(terms) != 2 {
+			return "", nil, fmt.Errorf("To rename a tag:\n  $ star --retag old new")
+		}
+		from, to = terms[:1], terms[1]
+	case op == "merge":
+		for o := 0; o < len(terms); o++ {
+			if terms[o] == "--into" && o + 1 < len(terms) {
+				to = terms[o + 1]
+				o++
+			} else {
+				from = append(from, terms[o])
+			}
+		}
+		if len(from) == 0 || len(to) == 0 {
+			return "", nil, fmt.Errorf("To merge tags:\n  $ star --merge-tags tag1 tag2 tag3 --into tag")
+		}
+	case op == "drop":
+		if len(terms) == 0 {
+			return "", nil, fmt.Errorf("To drop tags:\n  $ star --drop-tag tag1[ tag2...]")
+		}
+		from = terms
+	default:
+		return "", nil, fmt.Errorf("Unknown tag operation `%v`.", op)
+	}
+
+	to = cleanTagPath(to)
+	for o := range from {
+		from[o] = cleanTagPath(from[o])
+	}
+
+	// Tags without any of the `from` tags (or their children) are
+	// returned as they are.
+	changer := func(tags []string) []string {
+		var changed []string
+		hit := false
+	each:
+		for _, tag := range tags {
+			for _, parent := range from {
+				if isTagUnder(tag, parent) {
+					hit = true
+					if len(to) > 0 {
+						changed = append(changed, moveTag(tag, parent, to))
+					}
+					continue each
+				}
+			}
+			changed = append(changed, tag)
+		}
+
+		if !hit {
+			return tags
+		}
+		return dedupeTags(changed)
+	}
+
+	var desc string
+	switch {
+	case op == "rename":
+		desc = fmt.Sprintf("rename `%v` to `%v`", from[0], to)
+	case op == "merge":
+		desc = fmt.Sprintf("merge `%v` into `%v`", strings.Join(from, "`, `"), to)
+	default:
+		desc = fmt.Sprintf("drop `%v`", strings.Join(from, "`, `"))
+	}
+
+	return desc, changer, nil
+}
+
+// saveRetagsToStore passes the tags of each Record in the store
+// through the given function, in one pass, and returns the Records
+// whose tags changed, as they were and as changed.
+func saveRetagsToStore(conf *Config, retag func([]string) []string) ([]Record, []Record) {
+	var before, changed []Record
+
+	retagger := func(bk_file *os.File, record Record) {
+		if tags := retag(record.Tags); !reflect.DeepEqual(tags, record.Tags) {
+			before = append(before, record)
+			record.Tags = tags
+			changed = append(changed, record)
+		}
+		saveRecordToFile(bk_file, record)
+	}
+
+	updateStore(conf, retagger)
+
+	return before, changed
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 
@@ -18,7 +19,7 @@ func makeSearchAction(conf *Config, act *ActionCode, terms []string) func() {
 
 	match_act := getMatchAction(conf, act)
 	match_lim := getMatchLim(act, len(terms))
-	matcher := makeMatcher(terms, match_lim)
+	matcher := makeMatcher(conf, terms, match_lim)
 	sorter := makeSorter(act, (len(terms) > 0))
 
 	action := func() {
@@ -43,10 +44,23 @@ func getMatchAction(conf *Config, act *ActionCode) func([]Record) {
 	case act.Sub == SubActView:
 		action = makeRecordPrintCaller(printer)
 	case act.Sub == SubActPipe:
-		piper := makeRecordPiper(conf.Action, pipeRecordsAsStdin)
+		piper := makeRecordPiper(makePipeAction(conf))
 		action = makeRecordSelector("pipe", printer, makeActAndUpdater(conf, piper))
+	case act.Sub == SubActCopy:
+		action = makeRecordSelector("copy", printer, makeActAndUpdater(conf, makeRecordCopier(conf)))
+	case act.Sub == SubActTag:
+		tags := cleanInputTags(act.TagArgs)
+		if act.TagOp == "add" {
+			action = makeRecordSelector("tag", printer, makeTagger(conf, act.TagOp, tags))
+		} else {
+			action = makeRecordSelector("untag", printer, makeTagger(conf, act.TagOp, tags))
+		}
+	case act.Sub == SubActPin:
+		action = makeRecordSelector("pin", printer, makePinner(conf, true))
+	case act.Sub == SubActUnpin:
+		action = makeRecordSelector("unpin", printer, makePinner(conf, false))
 	case act.Sub == SubActEdit:
-		action = makeRecordSelector("edit", printer, makeEditor(conf))
+		action = makeRecordSelector("edit", printer, makeEditor(conf, !act.NoConfirm))
 	case act.Sub == SubActDelete:
 		action = makeRecordSelector("delete", printer, makeDeleter(conf))
 	default:  // Bork.
@@ -87,9 +101,50 @@ func getMatchLim(act *ActionCode, num_terms int) int {
 // as the record's overall match rate. The aggregate is used instead
 // of the average (sum of match rates / number of matches) because
 // it makes sense that a record that matches multiple times should
-// rate higher than those that don't.
-func makeMatcher(terms []string, lim int) func(Record) (float64, bool) {
+// rate higher than those that don't. Terms that start with `tag:`
+// only match the record's tags, counting the named tag and its
+// children, as in `tag:lang` matching `lang/go`. Terms that are tag
+// aliases, or have them, match any tag in the alias group. Terms
+// that start with `attr:` only match the record's attributes, and
+// terms that start with `note:` only match its note. Terms like
+// `is:pinned` match records in that state. Other terms match notes
+// too if the config says to. Expired records never match, unless the
+// config says to include them or a term is `is:expired`.
+func makeMatcher(conf *Config, terms []string, lim int) func(Record) (float64, bool) {
+	aliases := conf.TagAliases
+	now := time.Now()
+	include_expired := conf.IncludeExpired
+
+	// Each term's kind and alternatives are found once, up front.
+	groups := make([][]string, len(terms))
+	kinds := make([]string, len(terms))
+	for o, term := range terms {
+		switch {
+		case strings.HasPrefix(term, TagTermPrefix):
+			kinds[o] = TagTermPrefix
+			groups[o] = expandTagAliases(aliases, cleanTagPath(strings.TrimPrefix(term, TagTermPrefix)))
+		case strings.HasPrefix(term, AttrTermPrefix):
+			kinds[o] = AttrTermPrefix
+			groups[o] = []string{strings.TrimPrefix(term, AttrTermPrefix)}
+		case strings.HasPrefix(term, NoteTermPrefix):
+			kinds[o] = NoteTermPrefix
+			groups[o] = []string{strings.TrimPrefix(term, NoteTermPrefix)}
+		case strings.HasPrefix(term, IsTermPrefix):
+			kinds[o] = IsTermPrefix
+			groups[o] = []string{strings.TrimPrefix(term, IsTermPrefix)}
+			if groups[o][0] == MetaExpired {
+				include_expired = true
+			}
+		default:
+			groups[o] = expandTagAliases(aliases, term)
+		}
+	}
+
 	matcher := func(record Record) (float64, bool) {
+		if !include_expired && isRecordExpired(record, now) {
+			return 0.0, false
+		}
+
 		var match_rates []float64
 		matches := 0
 
@@ -98,17 +153,38 @@ func makeMatcher(terms []string, lim int) func(Record) (float64, bool) {
 		for o := 0; o < len(record.Tags); o++ {
 			strs = append(strs, record.Tags[o])
 		}
+		if conf.SearchNotes && len(record.Note) > 0 {
+			strs = append(strs, record.Note)
+		}
 		str_agg := strings.Join(strs, string(UnitSeparator))
 		// fmt.Printf("Aggregate line: %v\n", str_agg)
 
 		for o := 0; o < len(terms); o++ {
-			mult := strings.Count(str_agg, terms[o])
+			term := groups[o][0]
+			mult := 0
+
+			// Since aliases can contain each other, like `kube` and
+			// `kubernetes`, a text term counts its best alternative.
+			for _, alt := range groups[o] {
+				if kinds[o] == TagTermPrefix {
+					mult += countTagMatches(record.Tags, alt)
+				} else if kinds[o] == AttrTermPrefix {
+					mult += countAttrMatches(record.Attrs, alt)
+				} else if kinds[o] == NoteTermPrefix {
+					mult += strings.Count(record.Note, alt)
+				} else if kinds[o] == IsTermPrefix {
+					mult += countStateMatches(record, alt)
+				} else if count := strings.Count(str_agg, alt); count > mult {
+					mult = count
+					term = alt
+				}
+			}
 
 			if mult == 0 {
 				match_rates = append(match_rates, 0.0)
 			} else {
 				matches += 1
-				match_rates = append(match_rates, ((float64(len([]rune(terms[o]))) * float64(mult)) / float64(len([]rune(str_agg)))))
+				match_rates = append(match_rates, ((float64(len([]rune(term))) * float64(mult)) / float64(len([]rune(str_agg)))))
 			}
 		}
 
@@ -9,6 +9,21 @@ import (
 )
 
 
+// StdinReader is shared by all prompts so that input buffered while
+// reading one answer isn't lost to the next.
+var StdinReader = bufio.NewReader(os.Stdin)
+
+
+// isStdinTerminal returns true if stdin is a terminal, so there's
+// someone there to answer a prompt. If stdin is piped or redirected,
+// as with `--stdin` or `--bulk -`, it's been read to its end, or is
+// meant to be.
+func isStdinTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && (info.Mode() & os.ModeCharDevice) != 0
+}
+
+
 // makeRecordSelector receives a prompt verb, a record-printing
 // function, and a record-action function and returns an action
 // function that prints records and prompts the user for the ones
@@ -44,10 +59,15 @@ func makeRecordSelector(verb string, print func([]Record), act func([]Record)) f
 // stdout. It will collect the user's input, remove whitespace, and
 // return it.
 func promptForWantedRecord(verb string) string {
-	fmt.Printf("%v%v these records: ", strings.ToUpper(string(verb[0])), string(verb[1:]))
+	return promptForInput(fmt.Sprintf("%v%v these records: ", strings.ToUpper(string(verb[0])), string(verb[1:])))
+}
+
+// promptForInput prints the given prompt to stdout. It will collect
+// the user's input, remove whitespace, and return it.
+func promptForInput(prompt string) string {
+	fmt.Print(prompt)
 
-	reader := bufio.NewReader(os.Stdin)
-	input, _ := reader.ReadString('\n')
+	input, _ := StdinReader.ReadString('\n')
 
 	return strings.TrimSpace(input)
 }
@@ -101,6 +121,34 @@ func getIntsFromInput(input string) []int {
 	return clean
 }
 
+// promptForChoice prints the given prompt to stdout and reads the
+// user's answer until it matches one of the given choices, either
+// in full or by its first letter. An empty answer chooses the given
+// default, if that's not empty. The full choice will be returned.
+// If there's no more input, the return will be an empty string, and
+// callers should take that as the safest choice.
+func promptForChoice(prompt string, choices []string, def string) string {
+	for {
+		fmt.Print(prompt)
+
+		input, err := StdinReader.ReadString('\n')
+		input = strings.ToLower(strings.TrimSpace(input))
+
+		for _, choice := range choices {
+			if input != "" && (input == choice || input == choice[0:1]) {
+				return choice
+			}
+		}
+
+		if err != nil {
+			fmt.Println()
+			return ""
+		} else if input == "" && def != "" {
+			return def
+		}
+	}
+}
+
 // willDoNothing prints a message containing the given verb to stdout
 // indicating to the user that no action will be taken.
 func willDoNothing(verb string) {
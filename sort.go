@@ -41,7 +41,8 @@ func (a ByDateCreated) Less(i, j int) bool {
 
 // makeSorter returns the sorting function used in the multi-part
 // Search action function. If search terms are given, then the sort
-// sort will be by relevancy. Else, by date.
+// sort will be by relevancy. Else, by date. Either way, pinned
+// records come first.
 func makeSorter(act *ActionCode, has_terms bool) func([]Record) {
 	var sorter func([]Record)
 
@@ -67,5 +68,10 @@ func makeSorter(act *ActionCode, has_terms bool) func([]Record) {
 		}
 	}
 
-	return sorter
+	pinned_sorter := func(records []Record) {
+		sorter(records)
+		sortPinnedFirst(records)
+	}
+
+	return pinned_sorter
 }
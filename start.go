@@ -15,11 +15,43 @@ func main() {
 	case act.Main == MainActView:
 		action = makeSearchAction(readConfig(), act, terms)
 	case act.Main == MainActCreate:
-		action = makeCreateAction(readConfig(), terms)
+		action = makeCreateAction(readConfig(), act, terms)
 	case act.Main == MainActHelp:
 		action = func() {printUsageInformation()}
 	case act.Main == MainActInit:
 		action = makeInitializer(terms)
+	case act.Main == MainActClearClipboard:
+		action = makeClipboardClearer(terms)
+	case act.Main == MainActDedupe:
+		action = makeDeduper(readConfig(), !act.NoConfirm)
+	case act.Main == MainActRetag:
+		action = makeRetagger(readConfig(), act, terms)
+	case act.Main == MainActTags:
+		action = makeTagLister(readConfig(), act, terms)
+	case act.Main == MainActAliases:
+		action = makeAliaser(readConfig(), act, terms)
+	case act.Main == MainActGC:
+		action = makeCollector(readConfig(), act)
+	case act.Main == MainActTrash:
+		action = makeTrashLister(readConfig(), act, terms)
+	case act.Main == MainActRestore:
+		action = makeRestorer(readConfig(), act, terms)
+	case act.Main == MainActEmptyTrash:
+		action = makeTrashEmptier(readConfig(), act, terms)
+	case act.Main == MainActUndo:
+		action = makeUndoer(readConfig())
+	case act.Main == MainActRedo:
+		action = makeRedoer(readConfig())
+	case act.Main == MainActHistory:
+		action = makeHistoryLister(readConfig(), terms)
+	case act.Main == MainActBackups:
+		action = makeBackupLister(readConfig())
+	case act.Main == MainActRestoreBackup:
+		action = makeBackupRestorer(readConfig(), act, terms)
+	case act.Main == MainActCheck:
+		action = makeChecker(readConfig())
+	case act.Main == MainActRepair:
+		action = makeRepairer(readConfig(), act)
 	case act.Main == MainActDemo:
 		action = func() {fmt.Printf("Would make `demo` action.")}  // #TODO
 	default:
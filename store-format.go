@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+
+// StoreFormatVersion is the version of the store file's layout that
+// this version of STAR writes. Each version it can read has a reader
+// in `getStoreFormatReader`. The versions are:
+//   1: no header, and each entry has a value, tags, and metadata, and
+//      maybe attributes and a note
+//   2: like 1, but with a header
+// When the layout changes, the version goes up and a reader for the
+// new version is added, so older stores can still be read and can be
+// migrated when they're next written.
+const StoreFormatVersion = 2
+
+// StoreHeaderName starts the header, which is the first entry in the
+// store file. The header is the name and the version joined by the
+// unit separator. Since it has only one part, older versions of STAR
+// skip it like any other malformed entry.
+const StoreHeaderName = "star-store"
+
+
+// makeStoreHeader returns the header for the given version, as it's
+// written at the start of the store file.
+func makeStoreHeader(version int) string {
+	return StoreHeaderName + string(UnitSeparator) + strconv.Itoa(version) + string(GroupSeparator) + "\n"
+}
+
+// parseStoreHeader checks if the given entry is a store header. If so,
+// it returns the version and true. If not, it returns 0 and false.
+func parseStoreHeader(entry string) (int, bool) {
+	parts := splitField(strings.TrimSuffix(entry, string(GroupSeparator)))
+	if len(parts) != 2 || parts[0] != StoreHeaderName {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// getStoreFormatReader returns the function that transforms a split
+// entry in the given version of the store file into a Record. The
+// function's bool will be false if the entry isn't well-formed. If
+// the version isn't known, it returns an error.
+func getStoreFormatReader(version int) (func([]string) (Record, bool), error) {
+	switch {
+	case version == 1 || version == 2:
+		return readStoreEntryParts, nil
+	case version > StoreFormatVersion:
+		return nil, fmt.Errorf("the store file is format version %v, but this version of star only reads up to version %v", version, StoreFormatVersion)
+	default:
+		return nil, fmt.Errorf("the store file has an unknown format version (%v)", version)
+	}
+}
+
+// readStoreEntryParts reads a split entry in version 1 or 2 of the
+// store file.
+func readStoreEntryParts(parts []string) (Record, bool) {
+	if !doesEntryHaveParts(parts) {
+		return Record{}, false
+	}
+	return makeRecordFromParts(parts), true
+}
+
+// readStoreVersion returns the format version of the store file named
+// by the given string: the version in its header or, if it has none,
+// 1. A file that doesn't exist is the current version.
+func readStoreVersion(file_name string) int {
+	file, err := os.Open(file_name)
+	if os.IsNotExist(err) {
+		return StoreFormatVersion
+	}
+	checkForError(err)
+	defer file.Close()
+
+	entry, _ := readNextStoreEntry(bufio.NewReader(file))
+	if version, ok := parseStoreHeader(entry); ok {
+		return version
+	}
+
+	return 1
+}
+
+// migrateStoreFile checks the version of the user's store file and,
+// if it's older than the current version, backs it up and rewrites
+// it in the current version. It returns true if it did.
+func migrateStoreFile(conf *Config) bool {
+	version := readStoreVersion(conf.Store)
+	_, err := getStoreFormatReader(version)
+	checkForError(err)
+	if version >= StoreFormatVersion {
+		return false
+	}
+
+	backupStoreFile(conf)
+	updateStoreFile(conf.Store, saveRecordToFile)
+	fmt.Fprintf(os.Stderr, "Updated the store file from format version %v to %v. The old file was backed up to %v.\n", version, StoreFormatVersion, conf.BackupDir)
+
+	return true
+}
+
+// createStoreFile creates a store file, with the current header, at
+// the path named by the given string.
+func createStoreFile(path string) {
+	file := createFile(path)
+	defer file.Close()
+
+	_, err := file.WriteString(makeStoreHeader(StoreFormatVersion))
+	checkForError(err)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+
+// TagPathSeparator separates the levels of a hierarchical tag, as in
+// `lang/go`. A tag is the parent of all tags that start with it and
+// the separator.
+const TagPathSeparator = "/"
+
+// TagTermPrefix marks a search term that matches tags rather than
+// text, as in `tag:lang`. Such a term matches records with the tag
+// or any of its children.
+const TagTermPrefix = "tag:"
+
+
+// makeTagLister returns the Tags main action function, which prints
+// every tag of the records matching the given terms (or of all the
+// records, if there are no terms) as a tree, with the number of
+// records under each tag.
+func makeTagLister(conf *Config, act *ActionCode, terms []string) func() {
+	mergeConfigActions(conf, act)
+	matcher := makeMatcher(conf, terms, getMatchLim(act, len(terms)))
+
+	lister := func() {
+		records := readRecordsFromFile(conf.Store, matcher)
+		counts := countTagPaths(records)
+		if len(counts) == 0 {
+			fmt.Printf("No tags.\n")
+			return
+		}
+
+		printTagTree(counts)
+	}
+
+	return lister
+}
+
+// countTagPaths returns a map of each tag (and each tag's ancestors)
+// to the number of the given Records that have it or a child of it.
+func countTagPaths(records []Record) map[string]int {
+	counts := make(map[string]int)
+
+	for _, record := range records {
+		seen := make(map[string]bool)
+		for _, tag := range record.Tags {
+			for _, path := range tagAncestors(tag) {
+				if path != "" && !seen[path] {
+					counts[path] += 1
+					seen[path] = true
+				}
+			}
+		}
+	}
+
+	return counts
+}
+
+// printTagTree prints the tags in the given map, sorted, with each
+// child indented under its parent and followed by its count.
+func printTagTree(counts map[string]int) {
+	paths := make([]string, 0, len(counts))
+	for path := range counts {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		parts := strings.Split(path, TagPathSeparator)
+		fmt.Printf("%v%v (%v)\n", strings.Repeat("  ", len(parts) - 1), parts[len(parts) - 1], counts[path])
+	}
+}
+
+// tagAncestors returns the given tag's ancestors and the tag, from
+// the root down, so `a/b/c` gives `a`, `a/b`, and `a/b/c`.
+func tagAncestors(tag string) []string {
+	parts := strings.Split(tag, TagPathSeparator)
+	paths := make([]string, len(parts))
+
+	for o := range parts {
+		paths[o] = strings.Join(parts[:(o + 1)], TagPathSeparator)
+	}
+
+	return paths
+}
+
+// isTagUnder checks if the given tag is the given parent tag or one
+// of its descendants.
+func isTagUnder(tag string, parent string) bool {
+	return tag == parent || strings.HasPrefix(tag, parent + TagPathSeparator)
+}
+
+// moveTag returns the given tag with the given parent replaced by the
+// new parent, so moving `lang/go` from `lang` to `code` gives
+// `code/go`. The tag should be under the parent.
+func moveTag(tag string, parent string, new_parent string) string {
+	return new_parent + strings.TrimPrefix(tag, parent)
+}
+
+// cleanTagPath trims whitespace and stray separators from the given
+// tag, so ` lang//go/ ` becomes `lang/go`.
+func cleanTagPath(tag string) string {
+	var parts []string
+	for _, part := range strings.Split(strings.TrimSpace(tag), TagPathSeparator) {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			parts = append(parts, trimmed)
+		}
+	}
+
+	return strings.Join(parts, TagPathSeparator)
+}
+
+// countTagMatches returns the number of the given tags that are the
+// given parent tag or one of its descendants.
+func countTagMatches(tags []string, parent string) int {
+	count := 0
+	for _, tag := range tags {
+		if isTagUnder(tag, parent) {
+			count += 1
+		}
+	}
+	return count
+}
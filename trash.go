@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+
+// TrashEntry is a structure that holds a deleted Record, as it was,
+// and the time it was deleted.
+type TrashEntry struct {
+	Time int64 `json:"time"`
+	Record Record `json:"record"`
+}
+
+// TrashTimeFormat is the format of deletion times shown in the trash.
+const TrashTimeFormat = "2006-01-02 15:04"
+
+
+// trashFilePath returns the path to the trash for the store file
+// named by the given string. It's kept next to the store.
+func trashFilePath(store string) string {
+	return store + ".trash"
+}
+
+// makeTrashLister returns the Trash main action function, which
+// prints the deleted records that match the given terms, or all of
+// them, with the times they were deleted.
+func makeTrashLister(conf *Config, act *ActionCode, terms []string) func() {
+	lister := func() {
+		entries := readMatchingTrashEntries(conf, act, terms)
+		if len(entries) == 0 {
+			fmt.Printf("The trash is empty.\n")
+			return
+		}
+
+		getPrinter(act)(makeTrashDisplayRecords(entries))
+	}
+
+	return lister
+}
+
+// makeRestorer returns the Restore main action function, which lets
+// the user select deleted records that match the given terms and
+// puts them back in the store, with their original metadata.
+func makeRestorer(conf *Config, act *ActionCode, terms []string) func() {
+	restorer := func() {
+		entries := readMatchingTrashEntries(conf, act, terms)
+		displays := makeTrashDisplayRecords(entries)
+
+		restore := func(wanted []Record) {
+			used := make([]bool, len(displays))
+			var restored []TrashEntry
+
+			for _, want := range wanted {
+				for o, display := range displays {
+					if !used[o] && reflect.DeepEqual(display, want) {
+						used[o] = true
+						restored = append(restored, entries[o])
+						break
+					}
+				}
+			}
+
+			records := make([]Record, len(restored))
+			for o, entry := range restored {
+				records[o] = entry.Record
+			}
+
+			addRecordsToStore(conf, "restore", records)
+			removeTrashEntries(conf.Store, restored)
+			fmt.Printf("Restored %v.\n", pluralize(len(records), "entry", "entries"))
+		}
+
+		makeRecordSelector("restore", getPrinter(act), restore)(displays)
+	}
+
+	return restorer
+}
+
+// makeTrashEmptier returns the Empty Trash main action function,
+// which permanently removes the deleted records from the trash. If a
+// term is given, only records deleted before then are removed: it
+// can be a date like `2025-12-01` or an age like `30d` or `2w`.
+func makeTrashEmptier(conf *Config, act *ActionCode, terms []string) func() {
+	emptier := func() {
+		cutoff := time.Now()
+		if len(terms) > 0 {
+			var err error
+			if cutoff, err = parseTrashCutoff(terms[0], cutoff); err != nil {
+				fmt.Fprintf(os.Stderr, "To empty the trash of entries deleted before a date or an age:\n  $ star --empty-trash [2025-12-01|30d]\n")
+				return
+			}
+		}
+
+		var old []TrashEntry
+		for _, entry := range readTrashEntries(conf.Store) {
+			if entry.Time <= cutoff.Unix() {
+				old = append(old, entry)
+			}
+		}
+
+		if len(old) == 0 {
+			fmt.Printf("No entries to remove from the trash.\n")
+			return
+		}
+
+		fmt.Printf("Will permanently remove %v from the trash.\n", pluralize(len(old), "entry", "entries"))
+		if !act.NoConfirm && promptForChoice("Continue? (y/N) ", []string{"yes", "no"}, "no") != "yes" {
+			fmt.Printf("No changes saved.\n")
+			return
+		}
+
+		removeTrashEntries(conf.Store, old)
+		fmt.Printf("Removed %v.\n", pluralize(len(old), "entry", "entries"))
+	}
+
+	return emptier
+}
+
+// parseTrashCutoff reads the given date, like `2025-12-01`, or age,
+// like `30d`, and returns the time it stands for: the date, or the
+// given time less the age.
+func parseTrashCutoff(when string, now time.Time) (time.Time, error) {
+	if date, err := parseExpiryDate(when); err == nil {
+		return date, nil
+	}
+
+	later, err := parseExpiry(when, now)
+	if err != nil {
+		return now, err
+	}
+
+	return now.Add(-later.Sub(now)), nil
+}
+
+// readMatchingTrashEntries returns the entries in the trash whose
+// Records match the given terms, newest first. Expired Records are
+// included.
+func readMatchingTrashEntries(conf *Config, act *ActionCode, terms []string) []TrashEntry {
+	mergeConfigActions(conf, act)
+	conf.IncludeExpired = true
+	matcher := makeMatcher(conf, terms, getMatchLim(act, len(terms)))
+
+	var matches []TrashEntry
+	entries := readTrashEntries(conf.Store)
+	for o := len(entries) - 1; o >= 0; o-- {
+		if _, ok := matcher(entries[o].Record); ok {
+			matches = append(matches, entries[o])
+		}
+	}
+
+	return matches
+}
+
+// makeTrashDisplayRecords returns the Records in the given entries,
+// each with its deletion time added as a `deleted` attribute, so it
+// can be shown.
+func makeTrashDisplayRecords(entries []TrashEntry) []Record {
+	records := make([]Record, len(entries))
+
+	for o, entry := range entries {
+		records[o] = entry.Record
+		deleted := "deleted" + AttrSeparator + time.Unix(entry.Time, 0).Format(TrashTimeFormat)
+		records[o].Attrs = append(append([]string{}, entry.Record.Attrs...), deleted)
+	}
+
+	return records
+}
+
+// moveRecordsToTrash adds the given Records to the trash for the
+// given store file, marked as deleted now. If the config gives a
+// number of days to keep deleted records, older ones are removed.
+func moveRecordsToTrash(conf *Config, records []Record) {
+	if len(records) == 0 {
+		return
+	}
+
+	now := time.Now().Unix()
+	entries := readTrashEntries(conf.Store)
+	for _, record := range records {
+		entries = append(entries, TrashEntry{now, record})
+	}
+
+	if conf.TrashDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -conf.TrashDays).Unix()
+		var kept []TrashEntry
+		for _, entry := range entries {
+			if entry.Time > cutoff {
+				kept = append(kept, entry)
+			}
+		}
+		entries = kept
+	}
+
+	writeTrashEntries(conf.Store, entries)
+}
+
+// removeTrashEntries removes the given entries from the trash for
+// the given store file.
+func removeTrashEntries(store string, removals []TrashEntry) {
+	var kept []TrashEntry
+
+	for _, entry := range readTrashEntries(store) {
+		should_keep := true
+		for n, chk := range removals {
+			if reflect.DeepEqual(chk, entry) {
+				removals = append(removals[:n], removals[(n + 1):]...)
+				should_keep = false
+				break
+			}
+		}
+		if should_keep {
+			kept = append(kept, entry)
+		}
+	}
+
+	writeTrashEntries(store, kept)
+}
+
+// removeRecordsFromTrash removes the most recently deleted entry for
+// each of the given Records from the trash for the given store file.
+func removeRecordsFromTrash(store string, records []Record) {
+	if len(records) == 0 {
+		return
+	}
+
+	entries := readTrashEntries(store)
+	var removals []TrashEntry
+	for _, record := range records {
+		for o := len(entries) - 1; o >= 0; o-- {
+			if ((entries[o].Record.Value == record.Value) && (reflect.DeepEqual(entries[o].Record.Tags, record.Tags))) {
+				removals = append(removals, entries[o])
+				entries = append(entries[:o], entries[(o + 1):]...)
+				break
+			}
+		}
+	}
+
+	removeTrashEntries(store, removals)
+}
+
+// readTrashEntries reads the entries in the trash for the given store
+// file, oldest first. Lines that can't be read are skipped.
+func readTrashEntries(store string) []TrashEntry {
+	var entries []TrashEntry
+	readJSONLines(trashFilePath(store), func(line []byte) {
+		var entry TrashEntry
+		if err := json.Unmarshal(line, &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	})
+
+	return entries
+}
+
+// writeTrashEntries replaces the trash for the given store file with
+// the given entries.
+func writeTrashEntries(store string, entries []TrashEntry) {
+	values := make([]interface{}, len(entries))
+	for o, entry := range entries {
+		values[o] = entry
+	}
+	writeJSONLines(trashFilePath(store), values)
+}
@@ -10,28 +10,31 @@ import (
 
 
 // makeActAndUpdater returns a procedure for use in the Search action
-// function in which the wanted Records will be updated and those
-// updates will be written to the store file.
-func makeActAndUpdater(conf *Config, act func([]Record)) func([]Record) {
+// function in which the wanted Records will be acted on and, for
+// those that the action succeeded on, the metadata will be updated
+// and those updates will be written to the store file. The action
+// must return the Records that it succeeded on.
+func makeActAndUpdater(conf *Config, act func([]Record) []Record) func([]Record) {
 	updater := func(records []Record) {
-		updateRecordsMetadata(records)
-		saveUpdatesToStore(conf, records)
-		act(records)
+		acted := act(records)
+		if len(acted) > 0 {
+			updateRecordsMetadata(acted)
+			saveUpdatesToStore(conf, acted)
+		}
 	}
 
 	return updater
 }
 
 // updateRecordsMetadata updates the metadata for each Record in the
-// given slice.
+// given slice. An access count that can't be read starts over.
 func updateRecordsMetadata(records []Record) {
 	now := strconv.FormatInt(time.Now().Unix(), 10)
 
 	for _, record := range records {
 		switch {
-		case len(record.Meta) == 3:
-			old_count, err := strconv.Atoi(record.Meta[2])
-			checkForError(err)
+		case len(record.Meta) >= 3:
+			_, _, old_count := parseRecordMeta(record.Meta)
 			record.Meta[2] = strconv.Itoa(old_count + 1)
 			record.Meta[1] = now
 		default:
@@ -42,7 +45,8 @@ func updateRecordsMetadata(records []Record) {
 }
 
 // saveUpdatesToStore writes the updated records to the user's store
-// file.
+// file. Since only the metadata changes, it isn't journaled, and the
+// store isn't backed up first, though it's still migrated if need be.
 func saveUpdatesToStore(conf *Config, records []Record) {
 	updater := func(bk_file *os.File, record Record) {
 		should_bk := true
@@ -61,5 +65,6 @@ func saveUpdatesToStore(conf *Config, records []Record) {
 		}
 	}
 
+	migrateStoreFile(conf)
 	updateStoreFile(conf.Store, updater)
 }